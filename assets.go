@@ -0,0 +1,224 @@
+package vi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	ospath "path"
+	"strconv"
+	"strings"
+
+	"github.com/diontr00/vi/internal/utils"
+)
+
+// Return when the asset is not in the manifest
+var ErrAssetNotFound = errors.New("asset not found")
+
+// AssetsConfig defines the configuration of fingerprinted assets
+type AssetsConfig struct {
+	// Logical name to fingerprinted name , such as js/app.js to js/app.3f9a1c2b.js , usually generated at build time with Assets.Manifest
+	// Optional default to nil , which compute the manifest at startup by hashing every file
+	Manifest map[string]string
+	// Number of hex characters of the content hash in the fingerprinted name
+	// Optional default to 8
+	HashLength int
+	// The value for the cache-control max-age of the un-fingerprinted name , its define in term of second
+	// Optional default to 0 , which answer with no-cache so the client always revalidate
+	MaxAge int
+}
+
+// Assets serve the files of fs.FS under fingerprinted names , which is cached by the client forever
+// File start with . is not part of the manifest , and only file in the manifest is serve
+type Assets struct {
+	fsys fs.FS
+	// url prefix the assets are mount at
+	prefix string
+	// fingerprinted name by logical name
+	names map[string]string
+	// logical name by fingerprinted name
+	logical map[string]string
+	// cache-control of the un-fingerprinted name
+	cacheControl string
+}
+
+// cache-control of the fingerprinted name
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// Compute the manifest of the assets , use Manifest to save it at build time
+func NewAssets(fsys fs.FS, config *AssetsConfig) (*Assets, error) {
+	cfg := AssetsConfig{HashLength: 8}
+	if config != nil {
+		cfg = *config
+		if cfg.HashLength <= 0 {
+			cfg.HashLength = 8
+		}
+	}
+	if cfg.HashLength > sha256.Size*2 {
+		return nil, fmt.Errorf("hash length must not exceed %d", sha256.Size*2)
+	}
+
+	a := &Assets{
+		fsys:         fsys,
+		names:        make(map[string]string),
+		logical:      make(map[string]string),
+		cacheControl: "no-cache",
+	}
+	if cfg.MaxAge > 0 {
+		a.cacheControl = "public, max-age=" + strconv.Itoa(cfg.MaxAge)
+	}
+
+	if cfg.Manifest != nil {
+		for name, fingerprinted := range cfg.Manifest {
+			name = strings.TrimPrefix(name, "/")
+			if _, err := fs.Stat(fsys, name); err != nil {
+				return nil, fmt.Errorf("manifest entry %s : %w", name, err)
+			}
+			a.add(name, strings.TrimPrefix(fingerprinted, "/"))
+		}
+		return a, nil
+	}
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name != "." && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		hash, err := hashFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		a.add(name, fingerprint(name, hash[:cfg.HashLength]))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Register the assets under prefix , both the fingerprinted and the un-fingerprinted name are serve
+// Use Assets.URL or Assets.FuncMap to resolve the logical name to the fingerprinted url
+func (v *vi) Assets(prefix string, fsys fs.FS, config *AssetsConfig) (*Assets, error) {
+	a, err := NewAssets(fsys, config)
+	if err != nil {
+		return nil, err
+	}
+
+	a.prefix = strings.TrimSuffix(prefix, "/")
+	if a.prefix != "" && a.prefix[0] != '/' {
+		a.prefix = "/" + a.prefix
+	}
+	v.Mount(a.prefix, a)
+	return a, nil
+}
+
+func (a *Assets) add(name, fingerprinted string) {
+	a.names[name] = fingerprinted
+	a.logical[fingerprinted] = name
+}
+
+// Return the copy of the manifest , logical name to fingerprinted name
+func (a *Assets) Manifest() map[string]string {
+	manifest := make(map[string]string, len(a.names))
+	for name, fingerprinted := range a.names {
+		manifest[name] = fingerprinted
+	}
+	return manifest
+}
+
+// Return the fingerprinted url of the logical name , such as /assets/js/app.3f9a1c2b.js for js/app.js
+// Return ErrAssetNotFound if the name is not in the manifest
+func (a *Assets) URL(name string) (string, error) {
+	fingerprinted, ok := a.names[strings.TrimPrefix(name, "/")]
+	if !ok {
+		return "", fmt.Errorf("%w : %s", ErrAssetNotFound, name)
+	}
+	return a.prefix + "/" + fingerprinted, nil
+}
+
+// Return the template functions , asset resolve the logical name to the fingerprinted url
+// It can be use with html/template , or converted to text/template.FuncMap
+func (a *Assets) FuncMap() htmltemplate.FuncMap {
+	return htmltemplate.FuncMap{"asset": a.URL}
+}
+
+// Serve the asset , r.URL.Path is the name relative to the prefix
+func (a *Assets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		staticStatus(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(ospath.Clean("/"+r.URL.Path), "/")
+	fingerprinted, cacheControl := name, immutableCacheControl
+	if logical, ok := a.logical[name]; ok {
+		name = logical
+	} else if fingerprinted, ok = a.names[name]; ok {
+		cacheControl = a.cacheControl
+	} else {
+		staticStatus(w, http.StatusNotFound)
+		return
+	}
+
+	file, err := a.fsys.Open(name)
+	if err != nil {
+		staticError(w, name, err)
+		return
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		staticError(w, name, err)
+		return
+	}
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		staticError(w, name, errors.New("file is not seekable"))
+		return
+	}
+
+	w.Header().Set("Content-Type", utils.GetMIME(utils.GetFileExtension(name)))
+	w.Header().Set("Cache-Control", cacheControl)
+	// the fingerprint change with the content
+	w.Header().Set("ETag", `"`+fingerprinted+`"`)
+	http.ServeContent(w, r, name, stat.ModTime(), content)
+}
+
+// return the hex sha256 of the file content
+func hashFile(fsys fs.FS, name string) (string, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// insert the hash before the extension , js/app.js become js/app.3f9a1c2b.js
+func fingerprint(name, hash string) string {
+	dir, base := ospath.Split(name)
+	if i := strings.LastIndexByte(base, '.'); i > 0 {
+		return dir + base[:i] + "." + hash + base[i:]
+	}
+	return name + "." + hash
+}
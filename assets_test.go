@@ -0,0 +1,128 @@
+package vi
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing/fstest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Fingerprinted assets", func() {
+	var (
+		v      *vi
+		assets *Assets
+		fsys   fstest.MapFS
+	)
+	serve := func(method, url string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, http.NoBody)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		rec := httptest.NewRecorder()
+		v.ServeHTTP(rec, req)
+		return rec
+	}
+
+	BeforeEach(func() {
+		fsys = fstest.MapFS{
+			"js/app.js":      {Data: []byte("console.log('app')")},
+			"css/site.css":   {Data: []byte("body{}")},
+			"LICENSE":        {Data: []byte("MIT")},
+			".env":           {Data: []byte("SECRET")},
+			".cache/data.js": {Data: []byte("SECRET")},
+		}
+
+		var err error
+		v = New(nil)
+		assets, err = v.Assets("/assets/", fsys, &AssetsConfig{MaxAge: 60})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("Should fingerprint every file with its content hash", func() {
+		manifest := assets.Manifest()
+		Expect(manifest).To(HaveLen(3), "dotfiles are not part of the manifest")
+		Expect(manifest["js/app.js"]).To(MatchRegexp(`^js/app\.[0-9a-f]{8}\.js$`))
+		Expect(manifest["LICENSE"]).To(MatchRegexp(`^LICENSE\.[0-9a-f]{8}$`))
+
+		again, err := NewAssets(fsys, &AssetsConfig{HashLength: 12})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(again.Manifest()["js/app.js"]).To(HavePrefix(manifest["js/app.js"][:len("js/app.")+8]), "hash is stable")
+
+		fsys["js/app.js"] = &fstest.MapFile{Data: []byte("changed")}
+		changed, _ := NewAssets(fsys, nil)
+		Expect(changed.Manifest()["js/app.js"]).ToNot(Equal(manifest["js/app.js"]))
+		Expect(changed.Manifest()["css/site.css"]).To(Equal(manifest["css/site.css"]))
+
+		_, err = NewAssets(fsys, &AssetsConfig{HashLength: 65})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should resolve logical name to the fingerprinted url", func() {
+		url, err := assets.URL("/js/app.js")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(url).To(Equal("/assets/" + assets.Manifest()["js/app.js"]))
+
+		_, err = assets.URL("js/missing.js")
+		Expect(err).To(MatchError(ErrAssetNotFound))
+
+		var buf bytes.Buffer
+		tpl := htmltemplate.Must(htmltemplate.New("page").Funcs(assets.FuncMap()).Parse(`<script src="{{asset "js/app.js"}}"></script>`))
+		Expect(tpl.Execute(&buf, nil)).To(Succeed())
+		Expect(buf.String()).To(Equal(`<script src="` + url + `"></script>`))
+		Expect(htmltemplate.Must(htmltemplate.New("page").Funcs(assets.FuncMap()).Parse(`{{asset "nope.js"}}`)).Execute(&buf, nil)).ToNot(Succeed())
+	})
+
+	It("Should be serve alongside static file at the root", func() {
+		v = New(nil)
+		v.Static("/", &StaticConfig{Root: http.Dir("./.github/testdata/fs")})
+		assets, err := v.Assets("/assets", fsys, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		url, _ := assets.URL("js/app.js")
+		rec := serve("GET", url)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Cache-Control")).To(Equal(immutableCacheControl))
+		Expect(serve("GET", "/index.html").Code).To(Equal(http.StatusOK))
+	})
+
+	It("Should cache the fingerprinted name forever and the logical name shortly", func() {
+		url, _ := assets.URL("js/app.js")
+		rec := serve("GET", url)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(Equal("console.log('app')"))
+		Expect(rec.Header().Get("Cache-Control")).To(Equal("public, max-age=31536000, immutable"))
+		Expect(rec.Header().Get("Content-Type")).To(Equal("text/javascript"))
+		etag := rec.Header().Get("ETag")
+
+		rec = serve("GET", "/assets/js/app.js")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Cache-Control")).To(Equal("public, max-age=60"))
+		Expect(rec.Header().Get("ETag")).To(Equal(etag))
+
+		Expect(serve("GET", "/assets/js/app.js", "If-None-Match", etag).Code).To(Equal(http.StatusNotModified))
+		Expect(serve("HEAD", url).Body.Len()).To(BeZero())
+		Expect(serve("POST", url).Code).To(Equal(http.StatusMethodNotAllowed))
+		Expect(serve("GET", "/assets/.env").Code).To(Equal(http.StatusNotFound))
+		Expect(serve("GET", "/assets/js/app.00000000.js").Code).To(Equal(http.StatusNotFound))
+		Expect(serve("GET", "/assets/../../go.mod").Code).To(Equal(http.StatusNotFound))
+
+		v = New(nil)
+		_, err := v.Assets("static", fsys, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(serve("GET", "/static/css/site.css").Header().Get("Cache-Control")).To(Equal("no-cache"))
+	})
+
+	It("Should use the manifest generated at build time", func() {
+		built, err := NewAssets(fsys, &AssetsConfig{Manifest: map[string]string{"js/app.js": "js/app.build1.js"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(built.Manifest()).To(Equal(map[string]string{"js/app.js": "js/app.build1.js"}))
+		Expect(built.URL("js/app.js")).To(Equal("/js/app.build1.js"))
+
+		_, err = NewAssets(fsys, &AssetsConfig{Manifest: map[string]string{"js/gone.js": "js/gone.1.js"}})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,115 @@
+package vi
+
+import (
+	"encoding/json"
+	htmltemplate "html/template"
+	"net/http"
+	"net/url"
+	ospath "path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// listEntry is single entry of the directory listing
+type listEntry struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	IsDir   bool      `json:"isDir"`
+}
+
+// data of the HTML listing
+type listing struct {
+	Path    string
+	Entries []listEntry
+	// order of the next click on each column
+	Orders map[string]string
+}
+
+var listingTemplate = htmltemplate.Must(htmltemplate.New("listing").Funcs(htmltemplate.FuncMap{
+	"href": func(e listEntry) string {
+		if e.IsDir {
+			return url.PathEscape(e.Name) + "/"
+		}
+		return url.PathEscape(e.Name)
+	},
+	"time": func(t time.Time) string { return t.UTC().Format(time.RFC3339) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Index of {{.Path}}</title></head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+<tr><th><a href="?sort=name&amp;order={{.Orders.name}}">Name</a></th><th><a href="?sort=size&amp;order={{.Orders.size}}">Size</a></th><th><a href="?sort=time&amp;order={{.Orders.time}}">Modified</a></th></tr>
+{{- if ne .Path "/"}}
+<tr><td><a href="../">../</a></td><td></td><td></td></tr>
+{{- end}}
+{{- range .Entries}}
+<tr><td><a href="{{href .}}">{{.Name}}{{if .IsDir}}/{{end}}</a></td><td>{{if not .IsDir}}{{.Size}}{{end}}</td><td>{{time .ModTime}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// list the directory , directories come first then the entries are sort by the sort and order query
+// entries that can not be serve according to the policies of the config are not listed , name is the resolved name of dir
+func browse(w http.ResponseWriter, r *http.Request, dir http.File, name string, res *staticResolver) {
+	infos, err := dir.Readdir(-1)
+	if err != nil {
+		staticError(w, r.URL.Path, err)
+		return
+	}
+
+	entries := make([]listEntry, 0, len(infos))
+	for _, info := range infos {
+		if strings.HasPrefix(info.Name(), ".") && (!res.cfg.BrowseDotfiles || res.cfg.Dotfiles != DotfileAllow) {
+			continue
+		}
+		if res.denied(ospath.Join("/", r.URL.Path, info.Name())) || res.escapes(ospath.Join(name, info.Name())) {
+			continue
+		}
+		entries = append(entries, listEntry{Name: info.Name(), Size: info.Size(), ModTime: info.ModTime(), IsDir: info.IsDir()})
+	}
+
+	query := r.URL.Query()
+	key, desc := query.Get("sort"), query.Get("order") == "desc"
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		if desc {
+			a, b = b, a
+		}
+		switch key {
+		case "size":
+			if a.Size != b.Size {
+				return a.Size < b.Size
+			}
+		case "time":
+			if !a.ModTime.Equal(b.ModTime) {
+				return a.ModTime.Before(b.ModTime)
+			}
+		}
+		return a.Name < b.Name
+	})
+
+	if query.Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+		return
+	}
+
+	// sorting by the current column again reverse the order
+	orders := map[string]string{"name": "asc", "size": "asc", "time": "asc"}
+	if key == "" {
+		key = "name"
+	}
+	if !desc {
+		orders[key] = "desc"
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	listingTemplate.Execute(w, listing{Path: r.URL.Path, Entries: entries, Orders: orders})
+}
@@ -0,0 +1,151 @@
+package vi
+
+import (
+	"compress/gzip"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CompressConfig defines the on the fly gzip compression of static file
+type CompressConfig struct {
+	// File smaller than MinSize byte is not compress
+	// Optional default to 1024
+	MinSize int64
+	// MIME types that is compress , type/* match every subtype
+	// Optional default to text/* , application/json , application/javascript , application/xml , application/wasm and image/svg+xml
+	MIMETypes []string
+	// gzip compression level , 0 use gzip.DefaultCompression
+	// Optional default to gzip.DefaultCompression
+	Level int
+}
+
+// default MIME types of CompressConfig
+var compressMIMETypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/wasm",
+	"image/svg+xml",
+}
+
+// precompressed sibling of the file in order of preference , by content coding
+var precompressed = []struct {
+	coding string
+	ext    string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// Return the quality of the content coding in the Accept-Encoding header , 0 when it is not acceptable
+func acceptQuality(header, coding string) float64 {
+	star := 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.TrimSpace(name)
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				parsed = 0
+			}
+			q = parsed
+		}
+
+		switch {
+		case strings.EqualFold(name, coding):
+			return q
+		case name == "*":
+			star = q
+		}
+	}
+	return star
+}
+
+// whether the MIME type is in the list , type/* match every subtype
+func matchMIME(types []string, mime string) bool {
+	mime, _, _ = strings.Cut(mime, ";")
+	for _, t := range types {
+		if t == mime || strings.HasSuffix(t, "/*") && strings.HasPrefix(mime, t[:len(t)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter compress the body of 200 response , other response such as 304 is write as is
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	pool *sync.Pool
+	gz   *gzip.Writer
+}
+
+func (w *gzipResponseWriter) WriteHeader(code int) {
+	if code == http.StatusOK && w.gz == nil {
+		h := w.Header()
+		// the length and ranges refer to the uncompressed file
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		h.Set("Content-Encoding", "gzip")
+		w.gz = w.pool.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// flush the compressed body and put the writer back to the pool
+func (w *gzipResponseWriter) close() {
+	if w.gz != nil {
+		w.gz.Close()
+		w.pool.Put(w.gz)
+		w.gz = nil
+	}
+}
+
+// Return the weak ETag of the compressed representation , so it differ from the ETag of the file
+func gzipETag(etag string) string {
+	if etag == "" {
+		return ""
+	}
+	return `W/"` + strings.Trim(strings.TrimPrefix(etag, "W/"), `"`) + `-gzip"`
+}
+
+// open the precompressed sibling of the file with the most preferred content coding that the client accept
+// Return nil file when there is none
+func openPrecompressed(root http.FileSystem, name, acceptEncoding string) (file http.File, stat fs.FileInfo, sibling, coding string) {
+	best := 0.0
+	for _, p := range precompressed {
+		q := acceptQuality(acceptEncoding, p.coding)
+		if q <= best {
+			continue
+		}
+
+		f, err := root.Open(name + p.ext)
+		if err != nil {
+			continue
+		}
+		st, err := f.Stat()
+		if err != nil || st.IsDir() {
+			f.Close()
+			continue
+		}
+
+		if file != nil {
+			file.Close()
+		}
+		file, stat, sibling, coding, best = f, st, name+p.ext, p.coding, q
+	}
+	return file, stat, sibling, coding
+}
@@ -0,0 +1,199 @@
+package vi
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/diontr00/vi/internal/color"
+)
+
+// matcher represent extra condition beside method and path that request must satisfy
+// Value captured by the matcher is appended to params
+type matcher interface {
+	match(r *http.Request, params *[]Param) bool
+}
+
+// match host against template , port is ignored unless template include it
+type hostMatcher struct {
+	tpl      *template
+	withPort bool
+}
+
+func (m hostMatcher) match(r *http.Request, params *[]Param) bool {
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+	if !m.withPort {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+	}
+
+	return m.tpl.capture(strings.ToLower(host), params)
+}
+
+// match the request scheme against list of allowed scheme
+type schemeMatcher []string
+
+func (m schemeMatcher) match(r *http.Request, _ *[]Param) bool {
+	scheme := r.URL.Scheme
+	if scheme == "" {
+		scheme = "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+	}
+
+	for _, s := range m {
+		if strings.EqualFold(s, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// match the header value against template , nil template only require header to present
+type headerMatcher struct {
+	key string
+	tpl *template
+}
+
+func (m headerMatcher) match(r *http.Request, params *[]Param) bool {
+	values := r.Header.Values(m.key)
+	if m.tpl == nil {
+		return len(values) > 0
+	}
+
+	for _, value := range values {
+		if m.tpl.capture(value, params) {
+			return true
+		}
+	}
+	return false
+}
+
+// match the query value against template , nil template only require query key to present
+type queryMatcher struct {
+	key string
+	tpl *template
+}
+
+func (m queryMatcher) match(r *http.Request, params *[]Param) bool {
+	values, ok := r.URL.Query()[m.key]
+	if m.tpl == nil {
+		return ok
+	}
+
+	for _, value := range values {
+		if m.tpl.capture(value, params) {
+			return true
+		}
+	}
+	return false
+}
+
+// Host add host condition to the route , template can contain {name} or {name:regex} to capture the host part
+// Host is case insensitive , the request host and the literal part of the template are compared in lower case
+// example : r.Host("{tenant}.example.com") then GetParam(r, "tenant")
+func (rt *Route) Host(tpl string) *Route {
+	t, err := compileTemplate(lowerLiteral(tpl), `[^.]+`)
+	if err != nil {
+		panic(color.Red("invalid host template %s : %v", tpl, err))
+	}
+
+	rt.addMatcher(hostMatcher{tpl: t, withPort: hasPort(tpl)})
+	return rt
+}
+
+// Schemes add scheme condition to the route , example : r.Schemes("https")
+func (rt *Route) Schemes(schemes ...string) *Route {
+	if len(schemes) == 0 {
+		panic(color.Red("schemes must not be empty"))
+	}
+
+	rt.addMatcher(schemeMatcher(schemes))
+	return rt
+}
+
+// Headers add header condition to the route , pairs is the list of header key and value template
+// Empty value only require the header to present
+// example : r.Headers("X-Api-Version", "{version:v[0-9]+}", "Authorization", "")
+func (rt *Route) Headers(pairs ...string) *Route {
+	for i, kv := range splitPairs("headers", pairs) {
+		rt.addMatcher(headerMatcher{key: kv[0], tpl: valueTemplate("header", kv[1], i)})
+	}
+	return rt
+}
+
+// Queries add query condition to the route , pairs is the list of query key and value template
+// Empty value only require the query key to present
+// example : r.Queries("page", "{page:[0-9]+}", "debug", "")
+func (rt *Route) Queries(pairs ...string) *Route {
+	for i, kv := range splitPairs("queries", pairs) {
+		rt.addMatcher(queryMatcher{key: kv[0], tpl: valueTemplate("query", kv[1], i)})
+	}
+	return rt
+}
+
+// whether the host template contain port , colon inside curly bracket is not count
+func hasPort(tpl string) bool {
+	depth := 0
+	for i := range tpl {
+		switch tpl[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ':':
+			if depth == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lower case the template outside curly bracket , param name and regex are kept as is
+func lowerLiteral(tpl string) string {
+	b := []byte(tpl)
+	depth := 0
+	for i, c := range b {
+		switch {
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+		case depth == 0 && 'A' <= c && c <= 'Z':
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
+
+// split pairs into list of key , value , panic when length of pairs is odd
+func splitPairs(kind string, pairs []string) [][2]string {
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		panic(color.Red("%s must be pairs of key and value , got %d values", kind, len(pairs)))
+	}
+
+	kvs := make([][2]string, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		kvs = append(kvs, [2]string{pairs[i], pairs[i+1]})
+	}
+	return kvs
+}
+
+// compile header or query value template , return nil for empty value
+func valueTemplate(kind, value string, idx int) *template {
+	if value == "" {
+		return nil
+	}
+
+	t, err := compileTemplate(value, `.*`)
+	if err != nil {
+		panic(color.Red("invalid %s template at %d %s : %v", kind, idx, value, err))
+	}
+	return t
+}
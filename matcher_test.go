@@ -0,0 +1,96 @@
+package vi
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Route matchers", func() {
+	var v *vi
+
+	respond := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s tenant=%s version=%s page=%s", name, GetParam(r, "tenant"), GetParam(r, "version"), GetParam(r, "page"))
+		}
+	}
+
+	BeforeEach(func() {
+		v = New(&Config{Banner: false})
+		v.GET("/users", respond("admin")).Host("admin.example.com:8443")
+		v.GET("/users", respond("tenant")).Host("{tenant:[a-z]+}.example.com")
+		v.GET("/secure", respond("secure")).Schemes("https")
+		v.GET("/mixed", respond("mixed")).Host("API.{tenant:[a-z]+}.Example.com")
+		v.GET("/api", respond("versioned")).Headers("X-Api-Version", "{version:v[0-9]+}", "Authorization", "")
+		v.GET("/search", respond("search")).Queries("page", "{page:[0-9]+}", "debug", "")
+		v.GET("/search", respond("fallback"))
+	})
+
+	DescribeTable("Should match the request", func(req *http.Request, expectStatus int, expectBody string) {
+		rec := httptest.NewRecorder()
+		v.ServeHTTP(rec, req)
+
+		Expect(rec.Result().StatusCode).To(Equal(expectStatus))
+		if expectBody != "" {
+			Expect(rec.Body.String()).To(Equal(expectBody))
+		}
+	},
+		Entry("host with param", withHost(httptest.NewRequest("GET", "/users", http.NoBody), "acme.example.com:8080"), http.StatusOK, "tenant tenant=acme version= page="),
+		Entry("host with different case", withHost(httptest.NewRequest("GET", "/users", http.NoBody), "ACME.example.com"), http.StatusOK, "tenant tenant=acme version= page="),
+		Entry("host with different port", withHost(httptest.NewRequest("GET", "/users", http.NoBody), "admin.example.com:9443"), http.StatusOK, "tenant tenant=admin version= page="),
+		Entry("host with port", withHost(httptest.NewRequest("GET", "/users", http.NoBody), "admin.example.com:8443"), http.StatusOK, "admin tenant= version= page="),
+		Entry("host with mixed case template", withHost(httptest.NewRequest("GET", "/mixed", http.NoBody), "api.acme.example.com"), http.StatusOK, "mixed tenant=acme version= page="),
+		Entry("host with mixed case template and request", withHost(httptest.NewRequest("GET", "/mixed", http.NoBody), "Api.ACME.example.COM"), http.StatusOK, "mixed tenant=acme version= page="),
+		Entry("host not match", withHost(httptest.NewRequest("GET", "/users", http.NoBody), "acme.other.com"), http.StatusNotFound, ""),
+		Entry("host not match regex", withHost(httptest.NewRequest("GET", "/users", http.NoBody), "123.example.com"), http.StatusNotFound, ""),
+		Entry("https scheme", withTLS(httptest.NewRequest("GET", "/secure", http.NoBody)), http.StatusOK, "secure tenant= version= page="),
+		Entry("http scheme", httptest.NewRequest("GET", "/secure", http.NoBody), http.StatusNotFound, ""),
+		Entry("header", withHeader(httptest.NewRequest("GET", "/api", http.NoBody), "X-Api-Version", "v2", "Authorization", "token"), http.StatusOK, "versioned tenant= version=v2 page="),
+		Entry("header missing", withHeader(httptest.NewRequest("GET", "/api", http.NoBody), "X-Api-Version", "v2"), http.StatusNotFound, ""),
+		Entry("header not match", withHeader(httptest.NewRequest("GET", "/api", http.NoBody), "X-Api-Version", "2", "Authorization", "token"), http.StatusNotFound, ""),
+		Entry("query", httptest.NewRequest("GET", "/search?page=2&debug", http.NoBody), http.StatusOK, "search tenant= version= page=2"),
+		Entry("query not match fallback", httptest.NewRequest("GET", "/search?page=two&debug", http.NoBody), http.StatusOK, "fallback tenant= version= page="),
+	)
+
+	It("Should respond method not allowed only when matchers satisfy", func() {
+		req := withHost(httptest.NewRequest("POST", "/users", http.NoBody), "acme.example.com")
+		rec := httptest.NewRecorder()
+		v.ServeHTTP(rec, req)
+		Expect(rec.Result().StatusCode).To(Equal(http.StatusMethodNotAllowed))
+
+		req = withHost(httptest.NewRequest("POST", "/users", http.NoBody), "acme.other.com")
+		rec = httptest.NewRecorder()
+		v.ServeHTTP(rec, req)
+		Expect(rec.Result().StatusCode).To(Equal(http.StatusNotFound))
+	})
+
+	It("Should panic on invalid matcher", func() {
+		handler := func(w http.ResponseWriter, r *http.Request) {}
+		Ω(func() { v.GET("/", handler).Host("{tenant.example.com") }).Should(Panic())
+		Ω(func() { v.GET("/", handler).Host("{tenant:[a-z}.example.com") }).Should(Panic())
+		Ω(func() { v.GET("/", handler).Schemes() }).Should(Panic())
+		Ω(func() { v.GET("/", handler).Headers("X-Api-Version") }).Should(Panic())
+		Ω(func() { v.GET("/", handler).Queries("page", "{:[0-9]+}") }).Should(Panic())
+	})
+})
+
+func withHost(r *http.Request, host string) *http.Request {
+	r.Host = host
+	return r
+}
+
+func withTLS(r *http.Request) *http.Request {
+	r.TLS = &tls.ConnectionState{}
+	return r
+}
+
+func withHeader(r *http.Request, pairs ...string) *http.Request {
+	for i := 0; i < len(pairs); i += 2 {
+		r.Header.Set(pairs[i], pairs[i+1])
+	}
+	return r
+}
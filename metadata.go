@@ -0,0 +1,152 @@
+package vi
+
+// Schema is the JSON schema of request or response body , such as {"type": "object"}
+type Schema map[string]any
+
+// Response describe the response of the route for particular status
+type Response struct {
+	// Description of the response
+	Description string
+	// JSON schema of the response body , nil when the response has no body
+	Schema Schema
+}
+
+// Metadata is the user information attach to the route , it has no effect on routing
+// Use to generate docs , log the route on startup or audit the access control
+type Metadata struct {
+	// One line summary of the route
+	Summary string
+	// Longer description of the route
+	Description string
+	// Unique id of the operation in the OpenAPI document , default to the route name
+	OperationID string
+	// Tags use to group the route
+	Tags []string
+	// Auth scopes require to access the route
+	Scopes []string
+	// JSON schema of the request body
+	RequestBody Schema
+	// Responses of the route keyed by status
+	Responses map[int]Response
+	// Exclude the route from the OpenAPI document
+	Hidden bool
+	// Arbitrary value keyed by name
+	Values map[string]any
+}
+
+// copy the metadata , so the caller can not modify the route metadata
+func (m Metadata) clone() Metadata {
+	m.Tags = append([]string(nil), m.Tags...)
+	m.Scopes = append([]string(nil), m.Scopes...)
+	if m.Values != nil {
+		values := make(map[string]any, len(m.Values))
+		for k, v := range m.Values {
+			values[k] = v
+		}
+		m.Values = values
+	}
+	if m.Responses != nil {
+		responses := make(map[int]Response, len(m.Responses))
+		for k, v := range m.Responses {
+			responses[k] = v
+		}
+		m.Responses = responses
+	}
+	return m
+}
+
+// Summarize the route in one line
+func (rt *Route) Summary(summary string) *Route {
+	rt.router.mu.Lock()
+	defer rt.router.mu.Unlock()
+
+	rt.meta.Summary = summary
+	return rt
+}
+
+// Set the OpenAPI operation id of the route
+func (rt *Route) OperationID(id string) *Route {
+	rt.router.mu.Lock()
+	defer rt.router.mu.Unlock()
+
+	rt.meta.OperationID = id
+	return rt
+}
+
+// Set the JSON schema of the request body
+func (rt *Route) RequestBody(schema Schema) *Route {
+	rt.router.mu.Lock()
+	defer rt.router.mu.Unlock()
+
+	rt.meta.RequestBody = schema
+	return rt
+}
+
+// Describe the response for status , schema can be nil when the response has no body
+func (rt *Route) Response(status int, description string, schema Schema) *Route {
+	rt.router.mu.Lock()
+	defer rt.router.mu.Unlock()
+
+	if rt.meta.Responses == nil {
+		rt.meta.Responses = make(map[int]Response)
+	}
+	rt.meta.Responses[status] = Response{Description: description, Schema: schema}
+	return rt
+}
+
+// Exclude the route from the OpenAPI document
+func (rt *Route) Hide() *Route {
+	rt.router.mu.Lock()
+	defer rt.router.mu.Unlock()
+
+	rt.meta.Hidden = true
+	return rt
+}
+
+// Describe the route in detail
+func (rt *Route) Describe(description string) *Route {
+	rt.router.mu.Lock()
+	defer rt.router.mu.Unlock()
+
+	rt.meta.Description = description
+	return rt
+}
+
+// Tag the route , tags are append to the existing one
+func (rt *Route) Tag(tags ...string) *Route {
+	rt.router.mu.Lock()
+	defer rt.router.mu.Unlock()
+
+	rt.meta.Tags = append(rt.meta.Tags, tags...)
+	return rt
+}
+
+// Require auth scopes for the route , scopes are append to the existing one
+// vi does not enforce the scopes , it is up to the middleware
+func (rt *Route) Scope(scopes ...string) *Route {
+	rt.router.mu.Lock()
+	defer rt.router.mu.Unlock()
+
+	rt.meta.Scopes = append(rt.meta.Scopes, scopes...)
+	return rt
+}
+
+// Set arbitrary metadata value on the route
+func (rt *Route) Meta(key string, value any) *Route {
+	rt.router.mu.Lock()
+	defer rt.router.mu.Unlock()
+
+	if rt.meta.Values == nil {
+		rt.meta.Values = make(map[string]any)
+	}
+	rt.meta.Values[key] = value
+	return rt
+}
+
+// Get the copy of the route metadata
+func (rt *Route) GetMetadata() Metadata {
+	rt.router.mu.Lock()
+	defer rt.router.mu.Unlock()
+
+	return rt.meta.clone()
+}
@@ -0,0 +1,118 @@
+package vi
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/diontr00/vi/internal/color"
+)
+
+// method of the route that serve every method , it is try after the routes of the request method
+const methodAny = "*"
+
+// use to set the mount of a context
+var mountKey = mountCtxKey{}
+
+type mountCtxKey struct{}
+
+// mount hold the request path before the prefix is stripped
+type mount struct {
+	// original path of the request
+	path string
+	// the stripped prefix , accumulated across nested mounts
+	prefix string
+}
+
+// Mount the handler under prefix , every method and every path under the prefix is serve by the handler
+// The prefix is stripped from r.URL.Path before the handler is call , so /api/users is seen as /users when mount at /api
+// Use OriginalPath to get the path before stripping , middlewares registered with Use still apply
+// The handler can be another vi instance , which is serve as subrouter with its own not found handler
+// Param in the prefix must match exactly one segment , the mounted vi see only the params it capture itself
+func (v *vi) Mount(prefix string, handler http.Handler) {
+	if handler == nil {
+		panic(color.Red("handler must not be nil"))
+	}
+	if prefix == "" || prefix[0] != '/' {
+		prefix = "/" + prefix
+	}
+	prefix = strings.TrimSuffix(prefix, "/")
+	for _, seg := range pathParams(prefix) {
+		if seg.modifier != 0 || seg.span || seg.kind == rankWildcard {
+			panic(color.Red("mount prefix %s : param must match exactly one segment", prefix))
+		}
+	}
+
+	// number of segments to strip
+	depth := strings.Count(prefix, "/")
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, v.strip(r, depth))
+	}
+	// the mounted handler is opaque , so it is hidden from the OpenAPI document
+	v.Add(methodAny, prefix+"/*", serve).Hide()
+}
+
+// return the copy of the request with the first depth segments stripped from the path
+func (v *vi) strip(r *http.Request, depth int) *http.Request {
+	path, raw := v.routingPath(r)
+	rest := skipSegments(path, depth)
+
+	u := *r.URL
+	if raw {
+		u.RawPath = rest
+		if unescaped, err := url.PathUnescape(rest); err == nil {
+			u.Path = unescaped
+		}
+	} else {
+		u.Path = rest
+		// keep the raw path only when it still agree with the stripped path
+		if u.RawPath != "" {
+			u.RawPath = skipSegments(u.RawPath, depth)
+			if unescaped, err := url.PathUnescape(u.RawPath); err != nil || unescaped != u.Path {
+				u.RawPath = ""
+			}
+		}
+	}
+
+	m := &mount{path: r.URL.Path}
+	if parent, ok := r.Context().Value(mountKey).(*mount); ok {
+		m.path = parent.path
+		m.prefix = parent.prefix
+	}
+	m.prefix += strings.TrimSuffix(r.URL.Path, u.Path)
+
+	next := r.WithContext(context.WithValue(r.Context(), mountKey, m))
+	next.URL = &u
+	return next
+}
+
+// return the path without the first n segments , always start with /
+func skipSegments(path string, n int) string {
+	pos := 0
+	for i := 0; i < n; i++ {
+		next := strings.IndexByte(path[pos+1:], '/')
+		if next < 0 {
+			return "/"
+		}
+		pos += next + 1
+	}
+	return path[pos:]
+}
+
+// OriginalPath return the request path before the prefix is stripped by Mount
+// Return r.URL.Path when the request is not serve by mounted handler
+func OriginalPath(r *http.Request) string {
+	if m, ok := r.Context().Value(mountKey).(*mount); ok {
+		return m.path
+	}
+	return r.URL.Path
+}
+
+// return the prefix stripped by Mount , empty when the request is not serve by mounted handler
+func mountPrefix(r *http.Request) string {
+	if m, ok := r.Context().Value(mountKey).(*mount); ok {
+		return m.prefix
+	}
+	return ""
+}
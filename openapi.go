@@ -0,0 +1,380 @@
+package vi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// version of the generated OpenAPI document
+const openAPIVersion = "3.1.0"
+
+type (
+	// OpenAPI is the OpenAPI 3.1 document , only the part that vi can generate or read is represented
+	OpenAPI struct {
+		OpenAPI    string              `json:"openapi" yaml:"openapi"`
+		Info       OpenAPIInfo         `json:"info" yaml:"info"`
+		Servers    []OpenAPIServer     `json:"servers,omitempty" yaml:"servers,omitempty"`
+		Paths      map[string]PathItem `json:"paths" yaml:"paths"`
+		Components *Components         `json:"components,omitempty" yaml:"components,omitempty"`
+	}
+
+	// General information of the API
+	OpenAPIInfo struct {
+		Title       string `json:"title" yaml:"title"`
+		Version     string `json:"version" yaml:"version"`
+		Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	}
+
+	// Server that host the API
+	OpenAPIServer struct {
+		URL         string `json:"url" yaml:"url"`
+		Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	}
+
+	// Operations available on single path keyed by lower case method
+	PathItem map[string]*Operation
+
+	// Single API operation on a path
+	Operation struct {
+		OperationID string                        `json:"operationId,omitempty" yaml:"operationId,omitempty"`
+		Summary     string                        `json:"summary,omitempty" yaml:"summary,omitempty"`
+		Description string                        `json:"description,omitempty" yaml:"description,omitempty"`
+		Tags        []string                      `json:"tags,omitempty" yaml:"tags,omitempty"`
+		Parameters  []Parameter                   `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+		RequestBody *OperationBody                `json:"requestBody,omitempty" yaml:"requestBody,omitempty"`
+		Responses   map[string]*OperationResponse `json:"responses,omitempty" yaml:"responses,omitempty"`
+		Security    []map[string][]string         `json:"security,omitempty" yaml:"security,omitempty"`
+	}
+
+	// Parameter of the operation
+	Parameter struct {
+		Name        string `json:"name" yaml:"name"`
+		In          string `json:"in" yaml:"in"`
+		Description string `json:"description,omitempty" yaml:"description,omitempty"`
+		Required    bool   `json:"required,omitempty" yaml:"required,omitempty"`
+		Schema      Schema `json:"schema,omitempty" yaml:"schema,omitempty"`
+	}
+
+	// Request body of the operation
+	OperationBody struct {
+		Description string               `json:"description,omitempty" yaml:"description,omitempty"`
+		Required    bool                 `json:"required,omitempty" yaml:"required,omitempty"`
+		Content     map[string]MediaType `json:"content" yaml:"content"`
+	}
+
+	// Response of the operation
+	OperationResponse struct {
+		Description string               `json:"description" yaml:"description"`
+		Content     map[string]MediaType `json:"content,omitempty" yaml:"content,omitempty"`
+	}
+
+	// Schema of the body for particular content type
+	MediaType struct {
+		Schema Schema `json:"schema,omitempty" yaml:"schema,omitempty"`
+	}
+
+	// Reusable objects of the document
+	Components struct {
+		Schemas         map[string]Schema `json:"schemas,omitempty" yaml:"schemas,omitempty"`
+		SecuritySchemes map[string]Schema `json:"securitySchemes,omitempty" yaml:"securitySchemes,omitempty"`
+	}
+)
+
+// Configuration for OpenAPI document generation
+type OpenAPIConfig struct {
+	// General information of the API
+	// Optional default to title vi and version 0.0.0
+	Info OpenAPIInfo
+	// Servers that host the API
+	// Optional default to nil
+	Servers []OpenAPIServer
+	// Reusable schemas that route schema can refer to with {"$ref": "#/components/schemas/name"}
+	// Optional default to nil
+	Schemas map[string]Schema
+	// Security schemes of the API
+	// Optional default to nil
+	SecuritySchemes map[string]Schema
+	// Name of the security scheme that route scopes refer to , route without scopes has no security requirement
+	// Optional default to "" , scopes are not included in the document
+	Security string
+}
+
+// Generate OpenAPI document from the registered routes
+// Path param is converted to {name} with the pattern taken from the regex or helper ,
+// and route with optional param is expanded into path with and without the param.
+// The path without the param has the operation id suffixed with the omitted params , so operation id stay unique
+// Param that repeat such as :name* is documented as single segment , wildcard is document as {wildcard}
+func (v *vi) OpenAPI(config *OpenAPIConfig) *OpenAPI {
+	cfg := &OpenAPIConfig{}
+	if config != nil {
+		cfg = config
+	}
+
+	doc := &OpenAPI{
+		OpenAPI: openAPIVersion,
+		Info:    cfg.Info,
+		Servers: cfg.Servers,
+		Paths:   make(map[string]PathItem),
+	}
+	if doc.Info.Title == "" {
+		doc.Info.Title = "vi"
+	}
+	if doc.Info.Version == "" {
+		doc.Info.Version = "0.0.0"
+	}
+	if len(cfg.Schemas) > 0 || len(cfg.SecuritySchemes) > 0 {
+		doc.Components = &Components{Schemas: cfg.Schemas, SecuritySchemes: cfg.SecuritySchemes}
+	}
+
+	// rank of the route that document each operation , keyed by method and path
+	ranks := make(map[string][]int)
+	for _, info := range v.Routes() {
+		method := strings.ToLower(info.Method)
+		if info.Metadata.Hidden || !openAPIMethod(method) {
+			continue
+		}
+
+		rank := rankPath(info.Path)
+		variants := openAPIPaths(info.Path)
+		// the last variant include every param
+		full := variants[len(variants)-1]
+		for _, variant := range variants {
+			item, ok := doc.Paths[variant.path]
+			if !ok {
+				item = make(PathItem)
+				doc.Paths[variant.path] = item
+			}
+			// document the route that is serve , which is the more specific one or the one registered first
+			key := method + " " + variant.path
+			if owner, ok := ranks[key]; ok && !moreSpecific(rank, owner) {
+				continue
+			}
+			ranks[key] = rank
+
+			op := openAPIOperation(info, variant.params, cfg.Security)
+			if op.OperationID != "" && len(variant.params) < len(full.params) {
+				op.OperationID += "_without_" + strings.Join(omittedParams(full.params, variant.params), "_")
+			}
+			item[method] = op
+		}
+	}
+
+	return doc
+}
+
+// Encode the document as indented JSON
+func (doc *OpenAPI) JSON() ([]byte, error) {
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// Encode the document as YAML
+func (doc *OpenAPI) YAML() ([]byte, error) {
+	return yaml.Marshal(doc)
+}
+
+// Serve the OpenAPI document at path , the document is YAML if path end with .yaml or .yml , JSON otherwise
+// The document is generated on each request , so it always reflect the current routes. The route itself is hidden
+func (v *vi) ServeOpenAPI(path string, config *OpenAPIConfig) *Route {
+	asYAML := strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml")
+
+	return v.GET(path, func(w http.ResponseWriter, r *http.Request) {
+		var (
+			body []byte
+			err  error
+		)
+		doc := v.OpenAPI(config)
+		if asYAML {
+			w.Header().Set("Content-Type", "application/yaml")
+			body, err = doc.YAML()
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+			body, err = doc.JSON()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(body)
+	}).Hide()
+}
+
+// whether method is allowed as OpenAPI operation
+func openAPIMethod(method string) bool {
+	switch method {
+	case "get", "put", "post", "delete", "options", "head", "patch", "trace":
+		return true
+	}
+	return false
+}
+
+// openAPIPath is single OpenAPI path expand from route pattern along with its path params
+type openAPIPath struct {
+	path   string
+	params []Parameter
+}
+
+// Convert route pattern into OpenAPI paths , param that can match zero segment produce path with and without it
+func openAPIPaths(path string) []openAPIPath {
+	variants := []openAPIPath{{}}
+	segs := strings.Split(path, "/")[1:]
+	for i, pth := range segs {
+		seg, err := parseSegment(pth)
+		if err != nil {
+			seg = segment{kind: rankLiteral, name: pth}
+		}
+
+		var (
+			name     = seg.name
+			optional = seg.modifier == '?' || seg.modifier == '*'
+		)
+		switch {
+		case seg.kind == rankLiteral:
+			for i := range variants {
+				variants[i].path += "/" + seg.name
+			}
+			continue
+		case seg.parts != nil:
+			// each param of mixed segment is document separately
+			tpl, params := "", []Parameter(nil)
+			for _, part := range seg.parts {
+				if part.kind == rankLiteral {
+					tpl += part.name
+					continue
+				}
+				tpl += "{" + part.name + "}"
+				params = append(params, Parameter{Name: part.name, In: "path", Required: true, Schema: paramSchema(part)})
+			}
+			for i := range variants {
+				variants[i].path += "/" + tpl
+				variants[i].params = append(append([]Parameter(nil), variants[i].params...), params...)
+			}
+			continue
+		case seg.kind == rankWildcard:
+			if name == "" {
+				name = "wildcard"
+			}
+			// trailing catch all can match nothing
+			optional = i == len(segs)-1
+		}
+
+		param := Parameter{Name: name, In: "path", Required: true, Schema: paramSchema(seg)}
+		next := make([]openAPIPath, 0, len(variants)*2)
+		for _, variant := range variants {
+			if optional {
+				next = append(next, variant)
+			}
+			next = append(next, openAPIPath{
+				path:   variant.path + "/{" + name + "}",
+				params: append(append([]Parameter(nil), variant.params...), param),
+			})
+		}
+		variants = next
+	}
+
+	for i := range variants {
+		if variants[i].path == "" {
+			variants[i].path = "/"
+		}
+	}
+	return variants
+}
+
+// Return the name of the params that is in full but not in params
+func omittedParams(full, params []Parameter) []string {
+	var names []string
+	for _, p := range full {
+		found := false
+		for _, other := range params {
+			if other.Name == p.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
+
+// Return the schema of the path param , pattern is derive from the param regex unless the typed token decide the type
+func paramSchema(seg segment) Schema {
+	if seg.kind == rankWildcard {
+		return Schema{"type": "string"}
+	}
+
+	schema := Schema{"type": "string"}
+	if pt, ok := paramTypes[seg.typ]; ok {
+		schema = Schema{}
+		for k, v := range pt.schema {
+			schema[k] = v
+		}
+		if schema["type"] != "string" {
+			return schema
+		}
+	}
+	schema["pattern"] = anchor(seg.regex)
+	return schema
+}
+
+// Build the operation from route information
+func openAPIOperation(info RouteInfo, params []Parameter, security string) *Operation {
+	meta := info.Metadata
+	op := &Operation{
+		OperationID: meta.OperationID,
+		Summary:     meta.Summary,
+		Description: meta.Description,
+		Tags:        meta.Tags,
+		Parameters:  params,
+	}
+	if op.OperationID == "" {
+		op.OperationID = info.Name
+	}
+
+	// header and query matchers are required param
+	for _, m := range info.Route.loadMatchers() {
+		switch m := m.(type) {
+		case headerMatcher:
+			op.Parameters = append(op.Parameters, matcherParam(m.key, "header", m.tpl))
+		case queryMatcher:
+			op.Parameters = append(op.Parameters, matcherParam(m.key, "query", m.tpl))
+		}
+	}
+
+	if meta.RequestBody != nil {
+		op.RequestBody = &OperationBody{
+			Required: true,
+			Content:  map[string]MediaType{"application/json": {Schema: meta.RequestBody}},
+		}
+	}
+
+	if len(meta.Responses) > 0 {
+		op.Responses = make(map[string]*OperationResponse, len(meta.Responses))
+		for status, resp := range meta.Responses {
+			response := &OperationResponse{Description: resp.Description}
+			if resp.Schema != nil {
+				response.Content = map[string]MediaType{"application/json": {Schema: resp.Schema}}
+			}
+			op.Responses[strconv.Itoa(status)] = response
+		}
+	}
+
+	if security != "" && len(meta.Scopes) > 0 {
+		op.Security = []map[string][]string{{security: meta.Scopes}}
+	}
+
+	return op
+}
+
+// Build required param from header or query matcher , the template become the pattern
+func matcherParam(key, in string, tpl *template) Parameter {
+	param := Parameter{Name: key, In: in, Required: true, Schema: Schema{"type": "string"}}
+	if tpl != nil {
+		param.Schema["pattern"] = tpl.regex.String()
+	}
+	return param
+}
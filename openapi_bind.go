@@ -0,0 +1,538 @@
+package vi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Return by Bind when handler is given for operation id that is not in the document
+var ErrUnknownOperation = errors.New("unknown operation")
+
+// Load the OpenAPI document from file inside fsys , both JSON and YAML are accepted
+func LoadOpenAPI(fsys fs.FS, name string) (*OpenAPI, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return ParseOpenAPI(data)
+}
+
+// Load the OpenAPI document from file on disk , both JSON and YAML are accepted
+func LoadOpenAPIFile(name string) (*OpenAPI, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return ParseOpenAPI(data)
+}
+
+// Parse OpenAPI 3 document in JSON or YAML
+func ParseOpenAPI(data []byte) (*OpenAPI, error) {
+	doc := new(OpenAPI)
+	// JSON is valid YAML
+	if err := yaml.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document : %w", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported OpenAPI version %q", doc.OpenAPI)
+	}
+	return doc, nil
+}
+
+// Decode the path item , operation is keyed by method and param share by all operations are merge into each operation
+func (item *PathItem) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	var shared []Parameter
+	if params, ok := raw["parameters"]; ok {
+		if err := json.Unmarshal(params, &shared); err != nil {
+			return err
+		}
+	}
+
+	*item = make(PathItem)
+	for key, value := range raw {
+		if !openAPIMethod(key) {
+			continue
+		}
+		op := new(Operation)
+		if err := json.Unmarshal(value, op); err != nil {
+			return err
+		}
+		op.Parameters = mergeParams(shared, op.Parameters)
+		(*item)[key] = op
+	}
+	return nil
+}
+
+// Decode the path item , operation is keyed by method and param share by all operations are merge into each operation
+func (item *PathItem) UnmarshalYAML(node *yaml.Node) error {
+	var raw map[string]yaml.Node
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+
+	var shared []Parameter
+	if params, ok := raw["parameters"]; ok {
+		if err := params.Decode(&shared); err != nil {
+			return err
+		}
+	}
+
+	*item = make(PathItem)
+	for key, value := range raw {
+		if !openAPIMethod(key) {
+			continue
+		}
+		op := new(Operation)
+		if err := value.Decode(op); err != nil {
+			return err
+		}
+		op.Parameters = mergeParams(shared, op.Parameters)
+		(*item)[key] = op
+	}
+	return nil
+}
+
+// merge the shared params into the operation params , operation param with the same name and location take precedence
+func mergeParams(shared, params []Parameter) []Parameter {
+	if len(shared) == 0 {
+		return params
+	}
+
+	merged := append([]Parameter(nil), params...)
+	for _, s := range shared {
+		found := false
+		for _, p := range params {
+			if p.Name == s.Name && p.In == s.In {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, s)
+		}
+	}
+	return merged
+}
+
+// Build new vi from OpenAPI document , see Bind
+func NewFromOpenAPI(doc *OpenAPI, handlers map[string]http.HandlerFunc, config *Config) (*vi, error) {
+	v := New(config)
+	if err := v.Bind(doc, handlers); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// binding is the route to be register for single operation
+type binding struct {
+	method  string
+	pattern string
+	op      *Operation
+	handler http.HandlerFunc
+}
+
+// Bind register a route for each operation in the document , handlers is keyed by the operation id
+// Path template {id} become param with the regex derived from schema pattern or type
+// Path , query , header , cookie params and JSON body are validated before the handler run ,
+// invalid request is answer with RFC 7807 problem response.
+// Body larger than Config.MaxBodySize is answer with 413
+// Operation without handler is answer with 501 Not Implemented
+// Nothing is registered when error is return
+func (v *vi) Bind(doc *OpenAPI, handlers map[string]http.HandlerFunc) error {
+	if doc == nil {
+		return errors.New("OpenAPI document must not be nil")
+	}
+
+	var (
+		vd       = newValidator(doc.Components)
+		known    = make(map[string]bool)
+		bindings []binding
+		paths    = make([]string, 0, len(doc.Paths))
+	)
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		methods := make([]string, 0, len(doc.Paths[path]))
+		for method := range doc.Paths[path] {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+
+		for _, method := range methods {
+			op := doc.Paths[path][method]
+			if op == nil {
+				continue
+			}
+			if op.OperationID != "" {
+				if known[op.OperationID] {
+					return fmt.Errorf("duplicate operation id %s", op.OperationID)
+				}
+				known[op.OperationID] = true
+			}
+
+			pattern, err := openAPIPattern(path, op.Parameters)
+			if err != nil {
+				return err
+			}
+
+			handler, ok := handlers[op.OperationID]
+			if !ok || op.OperationID == "" || handler == nil {
+				handler = (&Problem{Status: http.StatusNotImplemented, Detail: "operation is not implemented"}).ServeHTTP
+			}
+			bindings = append(bindings, binding{
+				method:  strings.ToUpper(method),
+				pattern: pattern,
+				op:      op,
+				handler: validateRequest(op, vd, v.maxbodysize, handler),
+			})
+		}
+	}
+
+	for id := range handlers {
+		if !known[id] {
+			return fmt.Errorf("%w : %s", ErrUnknownOperation, id)
+		}
+	}
+
+	// register on staging router that start with the current table , so nothing is registered on error
+	base := v.table.Load()
+	staging := &vi{scope: v.scope, casepolicy: v.casepolicy, router: new(router)}
+	staging.table.Store(base)
+	if err := staging.bind(bindings); err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.table.Load() != base {
+		return errors.New("routes were modified while binding the OpenAPI document")
+	}
+	t := staging.table.Load()
+	t.adopt(v.router, v.scope.root(), v.scope.root())
+	v.table.Store(t)
+	return nil
+}
+
+// register the bindings , panic while registering is return as error
+func (v *vi) bind(bindings []binding) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	for _, b := range bindings {
+		rt := v.Add(b.method, b.pattern, b.handler)
+		if b.op.OperationID != "" {
+			rt.Name(b.op.OperationID)
+		}
+		rt.meta = operationMetadata(b.op)
+	}
+	return nil
+}
+
+// Convert the operation into route metadata , so the document can be generate back
+func operationMetadata(op *Operation) Metadata {
+	meta := Metadata{
+		OperationID: op.OperationID,
+		Summary:     op.Summary,
+		Description: op.Description,
+		Tags:        op.Tags,
+	}
+	if op.RequestBody != nil {
+		if media, ok := jsonMedia(op.RequestBody.Content); ok {
+			meta.RequestBody = media.Schema
+		}
+	}
+	for code, resp := range op.Responses {
+		status, err := strconv.Atoi(code)
+		if err != nil || resp == nil {
+			continue
+		}
+		if meta.Responses == nil {
+			meta.Responses = make(map[int]Response)
+		}
+		response := Response{Description: resp.Description}
+		if media, ok := jsonMedia(resp.Content); ok {
+			response.Schema = media.Schema
+		}
+		meta.Responses[status] = response
+	}
+	for _, security := range op.Security {
+		for _, scopes := range security {
+			meta.Scopes = append(meta.Scopes, scopes...)
+		}
+	}
+	return meta
+}
+
+// Convert OpenAPI path template into vi pattern , template can be mixed with literal text such as {name}.json
+// literal text must not contain : , since it would be taken as param
+func openAPIPattern(path string, params []Parameter) (string, error) {
+	segs := strings.Split(path, "/")
+	for i, seg := range segs {
+		if !strings.ContainsAny(seg, "{}") {
+			continue
+		}
+
+		var pattern strings.Builder
+		for rest := seg; rest != ""; {
+			start := strings.IndexByte(rest, '{')
+			if start < 0 {
+				start = len(rest)
+			}
+			if literal := rest[:start]; strings.ContainsAny(literal, ":}") {
+				return "", fmt.Errorf("unsupported path template %s in %s , literal text can not contain %q", seg, path, literal)
+			}
+			pattern.WriteString(rest[:start])
+			if start == len(rest) {
+				break
+			}
+
+			end := strings.IndexByte(rest[start:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unbalanced curly bracket in %s", path)
+			}
+			end += start
+			name := rest[start+1 : end]
+			if strings.ContainsAny(name, "{:") || name == "" {
+				return "", fmt.Errorf("invalid param name %s in %s", name, path)
+			}
+
+			regex := `.+`
+			for _, p := range params {
+				if p.In == "path" && p.Name == name {
+					regex = paramRegex(p.Schema)
+					break
+				}
+			}
+			if _, err := regexp.Compile(regex); err != nil {
+				return "", fmt.Errorf("invalid pattern %s for %s in %s : %w", regex, name, path, err)
+			}
+			// path is split by / before the param is parsed
+			if strings.Contains(regex, "/") {
+				return "", fmt.Errorf("pattern %s for %s in %s must not contain /", regex, name, path)
+			}
+			pattern.WriteString("{" + name + ":" + regex + "}")
+			rest = rest[end+1:]
+		}
+		segs[i] = pattern.String()
+	}
+	return strings.Join(segs, "/"), nil
+}
+
+// Derive the segment regex from param schema
+// anchored pattern is use as is , otherwise the segment only need to contain the pattern
+func paramRegex(schema Schema) string {
+	if pattern, ok := schema["pattern"].(string); ok && pattern != "" {
+		if strings.HasPrefix(pattern, "^") && strings.HasSuffix(pattern, "$") && !strings.HasSuffix(pattern, `\$`) {
+			return pattern[1 : len(pattern)-1]
+		}
+		return `.*(?:` + pattern + `).*`
+	}
+
+	switch schema["type"] {
+	case "integer":
+		return `-?[0-9]+`
+	case "number":
+		return `-?[0-9]+(?:\.[0-9]+)?`
+	case "boolean":
+		return `true|false`
+	}
+	return `.+`
+}
+
+// Return the JSON media type of the content , application/json or any +json type
+func jsonMedia(content map[string]MediaType) (MediaType, bool) {
+	if media, ok := content["application/json"]; ok {
+		return media, true
+	}
+	for contentType, media := range content {
+		if strings.HasSuffix(contentType, "+json") {
+			return media, true
+		}
+	}
+	return MediaType{}, false
+}
+
+// Wrap the handler with validation of the request against the operation , body larger than limit byte is rejected
+func validateRequest(op *Operation, vd *validator, limit int64, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var errs []ProblemError
+		for _, p := range op.Parameters {
+			values, present := paramValues(r, p)
+			if !present {
+				if p.Required || p.In == "path" {
+					errs = append(errs, ProblemError{In: p.In, Name: p.Name, Detail: "is required"})
+				}
+				continue
+			}
+
+			for _, vio := range vd.validate(p.Schema, paramValue(vd, p.Schema, values), "") {
+				errs = append(errs, ProblemError{In: p.In, Name: p.Name + vio.pointer, Detail: vio.detail})
+			}
+		}
+
+		if op.RequestBody != nil {
+			if media, ok := jsonMedia(op.RequestBody.Content); ok {
+				body, problem := validateBody(w, r, op.RequestBody, media, vd, limit)
+				if problem != nil {
+					problem.ServeHTTP(w, r)
+					return
+				}
+				errs = append(errs, body...)
+			}
+		}
+
+		if len(errs) > 0 {
+			(&Problem{
+				Status: http.StatusBadRequest,
+				Detail: "request does not match the API contract",
+				Errors: errs,
+			}).ServeHTTP(w, r)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// Return the raw values of the param and whether it present in the request
+func paramValues(r *http.Request, p Parameter) ([]string, bool) {
+	switch p.In {
+	case "path":
+		value := GetParam(r, p.Name)
+		return []string{value}, value != ""
+	case "query":
+		values, ok := r.URL.Query()[p.Name]
+		return values, ok
+	case "header":
+		values := r.Header.Values(p.Name)
+		return values, len(values) > 0
+	case "cookie":
+		cookie, err := r.Cookie(p.Name)
+		if err != nil {
+			return nil, false
+		}
+		return []string{cookie.Value}, true
+	}
+	return nil, false
+}
+
+// Convert raw param value into JSON value according to the schema type , so it can be validated
+// value that can not be converted is kept as string and fail the type check
+func paramValue(vd *validator, schema Schema, values []string) any {
+	if ref, ok := schema["$ref"].(string); ok {
+		if target, ok := vd.resolve(ref); ok {
+			schema = target
+		}
+	}
+
+	if schema["type"] == "array" {
+		items := asSchema(schema["items"])
+		// comma separated value of single param
+		if len(values) == 1 {
+			values = strings.Split(values[0], ",")
+		}
+		result := make([]any, len(values))
+		for i, value := range values {
+			result[i] = paramValue(vd, items, []string{value})
+		}
+		return result
+	}
+
+	value := values[0]
+	switch schema["type"] {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return json.Number(value)
+		}
+	case "boolean":
+		switch value {
+		case "true":
+			return true
+		case "false":
+			return false
+		}
+	}
+	return value
+}
+
+// Validate the JSON body , return problem when the body can not be validated at all
+// body larger than limit byte is answer with 413 , negative limit disable the check
+func validateBody(w http.ResponseWriter, r *http.Request, body *OperationBody, media MediaType, vd *validator, limit int64) ([]ProblemError, *Problem) {
+	var data []byte
+	if r.Body != nil {
+		reader := r.Body
+		if limit >= 0 {
+			reader = http.MaxBytesReader(w, r.Body, limit)
+		}
+		var err error
+		data, err = io.ReadAll(reader)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return nil, &Problem{
+					Status: http.StatusRequestEntityTooLarge,
+					Detail: fmt.Sprintf("request body must not exceed %d bytes", tooLarge.Limit),
+				}
+			}
+			return nil, &Problem{Status: http.StatusBadRequest, Detail: fmt.Sprintf("could not read request body : %v", err)}
+		}
+		r.Body.Close()
+		// handler can read the body again
+		r.Body = io.NopCloser(bytes.NewReader(data))
+	}
+
+	if len(data) == 0 {
+		if body.Required {
+			return []ProblemError{{In: "body", Detail: "request body is required"}}, nil
+		}
+		return nil, nil
+	}
+
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || contentType != "application/json" && !strings.HasSuffix(contentType, "+json") {
+		return nil, &Problem{
+			Status: http.StatusUnsupportedMediaType,
+			Detail: fmt.Sprintf("content type %q is not supported , expect JSON", r.Header.Get("Content-Type")),
+		}
+	}
+
+	var value any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		if err == nil {
+			err = errors.New("unexpected data after JSON value")
+		}
+		return []ProblemError{{In: "body", Detail: fmt.Sprintf("invalid JSON : %v", err)}}, nil
+	}
+
+	var errs []ProblemError
+	for _, vio := range vd.validate(media.Schema, value, "") {
+		errs = append(errs, ProblemError{In: "body", Name: vio.pointer, Detail: vio.detail})
+	}
+	return errs, nil
+}
@@ -0,0 +1,248 @@
+package vi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing/fstest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Router from OpenAPI document", func() {
+	var (
+		v   *vi
+		doc *OpenAPI
+	)
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte(GetParam(r, "petId") + string(body)))
+	}
+	handlers := map[string]http.HandlerFunc{
+		"listPets":  echo,
+		"createPet": echo,
+		"getPet":    echo,
+		"getOwner":  echo,
+	}
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		v.ServeHTTP(rec, req)
+		return rec
+	}
+	problem := func(rec *httptest.ResponseRecorder) Problem {
+		Expect(rec.Header().Get("Content-Type")).To(Equal("application/problem+json"))
+		var p Problem
+		Expect(json.Unmarshal(rec.Body.Bytes(), &p)).To(Succeed())
+		return p
+	}
+
+	BeforeEach(func() {
+		var err error
+		doc, err = LoadOpenAPIFile("./.github/testdata/openapi/petstore.yaml")
+		Expect(err).ToNot(HaveOccurred())
+		v, err = NewFromOpenAPI(doc, handlers, &Config{Banner: false})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("Should load the document from fs.FS in JSON", func() {
+		data, err := json.Marshal(doc)
+		Expect(err).ToNot(HaveOccurred())
+
+		loaded, err := LoadOpenAPI(fstest.MapFS{"api/openapi.json": {Data: data}}, "api/openapi.json")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(loaded.Paths).To(HaveLen(3))
+		Expect(loaded.Paths["/pets/{petId}"]["get"].Parameters).To(HaveLen(1), "path level param is merged")
+
+		var viaJSON OpenAPI
+		Expect(json.Unmarshal(data, &viaJSON)).To(Succeed())
+		Expect(viaJSON.Paths["/pets/{petId}"]).To(HaveLen(2))
+
+		_, err = ParseOpenAPI([]byte(`{"openapi": "2.0"}`))
+		Expect(err).To(HaveOccurred())
+		_, err = LoadOpenAPI(fstest.MapFS{}, "missing.yaml")
+		Expect(err).To(MatchError(os.ErrNotExist))
+	})
+
+	It("Should register a route for each operation", func() {
+		var routes []string
+		for _, info := range v.Routes() {
+			routes = append(routes, info.Method+" "+info.Path+" "+info.Name)
+		}
+		Expect(routes).To(ConsistOf(
+			"GET /pets listPets",
+			"POST /pets createPet",
+			"GET /pets/{petId:-?[0-9]+} getPet",
+			"DELETE /pets/{petId:-?[0-9]+} deletePet",
+			"GET /pets/{petId:-?[0-9]+}/owner/{code:[A-Z]{2}} getOwner",
+		))
+
+		url, err := v.URL("getOwner", "petId", "1", "code", "VN")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(url).To(Equal("/pets/1/owner/VN"))
+
+		generated := v.OpenAPI(nil)
+		Expect(generated.Paths["/pets"]["get"].Summary).To(Equal("List pets"))
+		Expect(generated.Paths["/pets"]["post"].RequestBody).ToNot(BeNil())
+	})
+
+	DescribeTable("Should validate the request", func(method, url string, header http.Header, body string, expectStatus int, expectErrors []ProblemError) {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		for k, values := range header {
+			for _, value := range values {
+				req.Header.Add(k, value)
+			}
+		}
+		rec := serve(req)
+		Expect(rec.Code).To(Equal(expectStatus), rec.Body.String())
+		// not found is answer by the router , not by the validation
+		if expectStatus == http.StatusOK || expectStatus == http.StatusNotFound {
+			return
+		}
+
+		p := problem(rec)
+		Expect(p.Status).To(Equal(expectStatus))
+		Expect(p.Type).To(Equal("about:blank"))
+		Expect(p.Instance).To(Equal(req.URL.Path))
+		Expect(p.Errors).To(ConsistOf(expectErrors))
+	},
+		Entry("valid query", "GET", "/pets?limit=10&tags=cat&tags=dog", nil, "", http.StatusOK, nil),
+		Entry("query type", "GET", "/pets?limit=ten", nil, "", http.StatusBadRequest,
+			[]ProblemError{{In: "query", Name: "limit", Detail: "must be of type integer"}}),
+		Entry("query range", "GET", "/pets?limit=101", nil, "", http.StatusBadRequest,
+			[]ProblemError{{In: "query", Name: "limit", Detail: "must be at most 100"}}),
+		Entry("query array item", "GET", "/pets?tags=cat,bird", nil, "", http.StatusBadRequest,
+			[]ProblemError{{In: "query", Name: "tags/1", Detail: "must be one of [cat dog]"}}),
+		Entry("path minimum", "GET", "/pets/0", nil, "", http.StatusBadRequest,
+			[]ProblemError{{In: "path", Name: "petId", Detail: "must be at least 1"}}),
+		Entry("path type is route constraint", "GET", "/pets/abc", nil, "", http.StatusNotFound, nil),
+		Entry("cookie", "GET", "/pets/1/owner/VN", http.Header{"Cookie": {"session=abc"}}, "", http.StatusBadRequest,
+			[]ProblemError{{In: "cookie", Name: "session", Detail: "length must be at least 4"}}),
+		Entry("valid body", "POST", "/pets", http.Header{"X-Request-Id": {"deadbeef"}, "Content-Type": {"application/json"}},
+			`{"name": "kitty", "age": 2}`, http.StatusOK, nil),
+		Entry("missing header and body", "POST", "/pets", nil, "", http.StatusBadRequest, []ProblemError{
+			{In: "header", Name: "X-Request-Id", Detail: "is required"},
+			{In: "body", Detail: "request body is required"},
+		}),
+		Entry("header pattern", "POST", "/pets", http.Header{"X-Request-Id": {"xyz"}, "Content-Type": {"application/json"}},
+			`{"name": "kitty"}`, http.StatusBadRequest,
+			[]ProblemError{{In: "header", Name: "X-Request-Id", Detail: "must match pattern ^[a-f0-9]{8}$"}}),
+		Entry("body schema", "POST", "/pets", http.Header{"X-Request-Id": {"deadbeef"}, "Content-Type": {"application/json"}},
+			`{"age": -1, "color": "red", "tags": ["a", "b", "c"]}`, http.StatusBadRequest, []ProblemError{
+				{In: "body", Name: "/name", Detail: "is required"},
+				{In: "body", Name: "/age", Detail: "must be at least 0"},
+				{In: "body", Name: "/color", Detail: "is not allowed"},
+				{In: "body", Name: "/tags", Detail: "must have at most 2 items"},
+			}),
+		Entry("invalid json", "POST", "/pets", http.Header{"X-Request-Id": {"deadbeef"}, "Content-Type": {"application/json"}},
+			`{"name": `, http.StatusBadRequest, []ProblemError{{In: "body", Detail: "invalid JSON : unexpected EOF"}}),
+		Entry("unsupported media type", "POST", "/pets", http.Header{"X-Request-Id": {"deadbeef"}, "Content-Type": {"text/plain"}},
+			`name`, http.StatusUnsupportedMediaType, nil),
+		Entry("not implemented", "DELETE", "/pets/1", nil, "", http.StatusNotImplemented, nil),
+	)
+
+	It("Should pass the body to the handler", func() {
+		req := httptest.NewRequest("POST", "/pets", strings.NewReader(`{"name": "kitty"}`))
+		req.Header.Set("X-Request-Id", "deadbeef")
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		Expect(serve(req).Body.String()).To(Equal(`{"name": "kitty"}`))
+	})
+
+	It("Should reject body larger than the limit", func() {
+		post := func(body string) *http.Request {
+			req := httptest.NewRequest("POST", "/pets", strings.NewReader(body))
+			req.Header.Set("X-Request-Id", "deadbeef")
+			req.Header.Set("Content-Type", "application/json")
+			return req
+		}
+		large := `{"name": "` + strings.Repeat("k", defaultMaxBodySize) + `"}`
+
+		rec := serve(post(large))
+		Expect(rec.Code).To(Equal(http.StatusRequestEntityTooLarge))
+		Expect(problem(rec).Detail).To(Equal("request body must not exceed 1048576 bytes"))
+
+		var err error
+		v, err = NewFromOpenAPI(doc, handlers, &Config{Banner: false, MaxBodySize: 16})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(serve(post(`{"name": "kitty"}`)).Code).To(Equal(http.StatusRequestEntityTooLarge))
+		Expect(serve(post(`{"name": "kit"}`)).Code).To(Equal(http.StatusOK))
+
+		v, err = NewFromOpenAPI(doc, handlers, &Config{Banner: false, MaxBodySize: -1})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(serve(post(large)).Code).To(Equal(http.StatusOK))
+	})
+
+	It("Should reject invalid binding without registering anything", func() {
+		v = New(&Config{Banner: false})
+		v.GET("/pets", echo)
+
+		err := v.Bind(doc, map[string]http.HandlerFunc{"unknown": echo})
+		Expect(err).To(MatchError(ErrUnknownOperation))
+
+		err = v.Bind(doc, nil)
+		Expect(err).To(HaveOccurred(), "GET /pets is already registered")
+		Expect(v.Routes()).To(HaveLen(1))
+
+		custom, err := ParseOpenAPI([]byte(`
+openapi: 3.0.3
+info: {title: custom, version: "1"}
+paths:
+  /files/{name}:copy:
+    post: {}
+`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(New(nil).Bind(custom, nil)).ToNot(Succeed(), "literal : would be taken as param")
+	})
+
+	It("Should bind template mixed with literal text", func() {
+		mixed, err := ParseOpenAPI([]byte(`
+openapi: 3.0.3
+info: {title: mixed, version: "1"}
+paths:
+  /files/{name}.{ext}:
+    get:
+      operationId: getFile
+      parameters:
+        - {name: ext, in: path, required: true, schema: {type: string, enum: [json, yaml]}}
+`))
+		Expect(err).ToNot(HaveOccurred())
+		v = New(&Config{Banner: false})
+		Expect(v.Bind(mixed, map[string]http.HandlerFunc{"getFile": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(GetParam(r, "name") + " " + GetParam(r, "ext")))
+		}})).To(Succeed())
+
+		Expect(serve(httptest.NewRequest("GET", "/files/report.json", http.NoBody)).Body.String()).To(Equal("report json"))
+		Expect(serve(httptest.NewRequest("GET", "/files/report.xml", http.NoBody)).Code).To(Equal(http.StatusBadRequest))
+	})
+})
+
+var _ = DescribeTable("OpenAPI param regex", func(schema Schema, expect string) {
+	Expect(paramRegex(schema)).To(Equal(expect))
+},
+	Entry("anchored pattern", Schema{"pattern": "^[a-z]+$"}, "[a-z]+"),
+	Entry("unanchored pattern", Schema{"pattern": "[a-z]"}, ".*(?:[a-z]).*"),
+	Entry("escaped dollar", Schema{"pattern": `^price\$`}, `.*(?:^price\$).*`),
+	Entry("integer", Schema{"type": "integer"}, "-?[0-9]+"),
+	Entry("boolean", Schema{"type": "boolean"}, "true|false"),
+	Entry("string", Schema{"type": "string"}, ".+"),
+)
+
+var _ = DescribeTable("JSON value equality", func(a, b any, expect bool) {
+	Expect(equalJSON(a, b)).To(Equal(expect))
+	Expect(equalJSON(b, a)).To(Equal(expect))
+},
+	Entry("number by value", json.Number("1"), 1.0, true),
+	Entry("number and string", json.Number("1"), "1", false),
+	Entry("string", "cat", "cat", true),
+	Entry("bool", true, false, false),
+	Entry("null", nil, nil, true),
+	Entry("null and string", nil, "", false),
+	Entry("array", []any{"a", json.Number("2")}, []any{"a", 2.0}, true),
+	Entry("array length", []any{"a"}, []any{"a", "b"}, false),
+	Entry("object", map[string]any{"a": []any{true}}, Schema{"a": []any{true}}, true),
+	Entry("object missing key", map[string]any{"a": nil}, map[string]any{"b": nil}, false),
+	Entry("object and array", map[string]any{}, []any{}, false),
+)
@@ -0,0 +1,149 @@
+package vi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v3"
+)
+
+var _ = DescribeTable("OpenAPI path conversion", func(path string, expectPaths []string, expectParams [][]string) {
+	variants := openAPIPaths(path)
+
+	var paths []string
+	var params [][]string
+	for _, variant := range variants {
+		paths = append(paths, variant.path)
+		var names []string
+		for _, p := range variant.params {
+			Expect(p.In).To(Equal("path"))
+			Expect(p.Required).To(BeTrue())
+			names = append(names, p.Name)
+		}
+		params = append(params, names)
+	}
+	Expect(paths).To(Equal(expectPaths))
+	Expect(params).To(Equal(expectParams))
+},
+	Entry("root", "/", []string{"/"}, [][]string{nil}),
+	Entry("static", "/user/list", []string{"/user/list"}, [][]string{nil}),
+	Entry("named param", "/user/:name", []string{"/user/{name}"}, [][]string{{"name"}}),
+	Entry("regex param", "/user/{id:[0-9]+}/post", []string{"/user/{id}/post"}, [][]string{{"id"}}),
+	Entry("optional param", "/user/:name?", []string{"/user", "/user/{name}"}, [][]string{nil, {"name"}}),
+	Entry("optional in the middle", "/user/:name?/:id",
+		[]string{"/user/{id}", "/user/{name}/{id}"}, [][]string{{"id"}, {"name", "id"}}),
+	Entry("two optional params", "/:a?/:b?",
+		[]string{"/", "/{b}", "/{a}", "/{a}/{b}"}, [][]string{nil, {"b"}, {"a"}, {"a", "b"}}),
+	Entry("repeat param", "/file/:path+", []string{"/file/{path}"}, [][]string{{"path"}}),
+	Entry("wildcard", "/static/*", []string{"/static", "/static/{wildcard}"}, [][]string{nil, {"wildcard"}}),
+	Entry("named catch all", "/static/*path", []string{"/static", "/static/{path}"}, [][]string{nil, {"path"}}),
+	Entry("catch all in the middle", "/repo/*path/raw", []string{"/repo/{path}/raw"}, [][]string{{"path"}}),
+	Entry("mixed segment", "/img/:name.:ext/v:version", []string{"/img/{name}.{ext}/v{version}"}, [][]string{{"name", "ext", "version"}}),
+)
+
+var _ = Describe("OpenAPI document generation", func() {
+	var v *vi
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+
+	BeforeEach(func() {
+		v = New(&Config{Banner: false})
+		RegisterHelper("ip", `\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}`)
+		v.GET("/user/{id:[0-9]+}", handler).Name("getUser").
+			Summary("Get user").
+			Tag("user").
+			Scope("user:read").
+			Response(http.StatusOK, "The user", Schema{"$ref": "#/components/schemas/User"}).
+			Response(http.StatusNotFound, "Not found", nil)
+		v.POST("/user", handler).OperationID("createUser").
+			RequestBody(Schema{"$ref": "#/components/schemas/User"}).
+			Queries("dry", "{dry:true|false}")
+		v.GET("/location/:ip", handler).Headers("X-Api-Key", "")
+		v.GET("/internal", handler).Hide()
+		v.Add("PURGE", "/cache", handler)
+	})
+
+	It("Should generate operation from route and metadata", func() {
+		doc := v.OpenAPI(&OpenAPIConfig{
+			Info:            OpenAPIInfo{Title: "User API", Version: "1.0.0"},
+			Schemas:         map[string]Schema{"User": {"type": "object"}},
+			SecuritySchemes: map[string]Schema{"oauth": {"type": "oauth2"}},
+			Security:        "oauth",
+		})
+
+		Expect(doc.OpenAPI).To(Equal("3.1.0"))
+		Expect(doc.Info.Title).To(Equal("User API"))
+		Expect(doc.Components.Schemas).To(HaveKey("User"))
+		Expect(doc.Paths).To(HaveLen(3), "hidden and non standard method route are excluded")
+
+		get := doc.Paths["/user/{id}"]["get"]
+		Expect(get.OperationID).To(Equal("getUser"))
+		Expect(get.Summary).To(Equal("Get user"))
+		Expect(get.Tags).To(Equal([]string{"user"}))
+		Expect(get.Security).To(Equal([]map[string][]string{{"oauth": {"user:read"}}}))
+		Expect(get.Parameters).To(Equal([]Parameter{
+			{Name: "id", In: "path", Required: true, Schema: Schema{"type": "string", "pattern": "^(?:[0-9]+)$"}},
+		}))
+		Expect(get.Responses).To(HaveLen(2))
+		Expect(get.Responses["200"].Content["application/json"].Schema).To(HaveKey("$ref"))
+		Expect(get.Responses["404"].Content).To(BeNil())
+
+		post := doc.Paths["/user"]["post"]
+		Expect(post.OperationID).To(Equal("createUser"))
+		Expect(post.RequestBody.Content).To(HaveKey("application/json"))
+		Expect(post.Security).To(BeNil())
+		Expect(post.Parameters).To(Equal([]Parameter{
+			{Name: "dry", In: "query", Required: true, Schema: Schema{"type": "string", "pattern": "^(true|false)$"}},
+		}))
+
+		location := doc.Paths["/location/{ip}"]["get"]
+		Expect(location.Parameters).To(HaveLen(2))
+		Expect(location.Parameters[0].Schema["pattern"]).To(Equal(`^(?:\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3})$`))
+		Expect(location.Parameters[1]).To(Equal(Parameter{Name: "X-Api-Key", In: "header", Required: true, Schema: Schema{"type": "string"}}))
+	})
+
+	It("Should document the route that is serve when optional param expand into existing path", func() {
+		v.GET("/user/:name?", handler).OperationID("listOrGetUser")
+		v.GET("/user", handler).OperationID("listUser")
+		v.GET("/video/:title?", handler).Name("video")
+
+		doc := v.OpenAPI(nil)
+		Expect(doc.Info).To(Equal(OpenAPIInfo{Title: "vi", Version: "0.0.0"}))
+		route, ok := v.Match(httptest.NewRequest("GET", "/user", http.NoBody))
+		Expect(ok).To(BeTrue())
+		Expect(route.GetPath()).To(Equal("/user"))
+		Expect(doc.Paths["/user"]["get"].OperationID).To(Equal("listUser"))
+		Expect(doc.Paths["/user/{name}"]["get"].OperationID).To(Equal("listOrGetUser"))
+
+		Expect(doc.Paths["/video/{title}"]["get"].OperationID).To(Equal("video"))
+		Expect(doc.Paths["/video"]["get"].OperationID).To(Equal("video_without_title"))
+
+		ids := make(map[string]bool)
+		for _, item := range doc.Paths {
+			for _, op := range item {
+				Expect(ids).ToNot(HaveKey(op.OperationID), "operation id must be unique")
+				ids[op.OperationID] = true
+			}
+		}
+	})
+
+	DescribeTable("Should serve the document", func(path, contentType string, unmarshal func([]byte, any) error) {
+		v.ServeOpenAPI(path, nil)
+		rec := httptest.NewRecorder()
+		v.ServeHTTP(rec, httptest.NewRequest("GET", path, http.NoBody))
+
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Content-Type")).To(Equal(contentType))
+
+		var doc map[string]any
+		Expect(unmarshal(rec.Body.Bytes(), &doc)).To(Succeed())
+		Expect(doc).To(HaveKeyWithValue("openapi", "3.1.0"))
+		Expect(doc["paths"]).To(HaveKey("/user/{id}"))
+		Expect(doc["paths"]).ToNot(HaveKey(path), "spec route should be hidden")
+	},
+		Entry("json", "/openapi.json", "application/json", json.Unmarshal),
+		Entry("yaml", "/docs/openapi.yaml", "application/yaml", yaml.Unmarshal),
+	)
+})
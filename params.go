@@ -0,0 +1,291 @@
+package vi
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Return by the param accessors when the param is not captured for the request
+var ErrParamNotFound = errors.New("param not found")
+
+// Param is single captured param
+type Param struct {
+	Key   string
+	Value string
+}
+
+// captured params of the request in capture order , along with the route that capture them
+// It is taken from paramsPool when the request is resolve and put back after the handler return
+type routeParams struct {
+	route  *Route
+	values []Param
+}
+
+// pool of routeParams , so capturing params does not allocate on every request
+var paramsPool = sync.Pool{
+	New: func() any {
+		return &routeParams{values: make([]Param, 0, 8)}
+	},
+}
+
+// return the routeParams to the pool , value is clear so the url is not retain
+func (rp *routeParams) release() {
+	clear(rp.values)
+	rp.values = rp.values[:0]
+	rp.route = nil
+	paramsPool.Put(rp)
+}
+
+// paramsContext attach the params to the request context
+// It replace context.WithValue , so the params is found without walking the context chain
+type paramsContext struct {
+	context.Context
+	params *routeParams
+}
+
+func (c *paramsContext) Value(key any) any {
+	if key == contextKey {
+		return c.params
+	}
+	return c.Context.Value(key)
+}
+
+// paramType is the typed constraint token , such as :id<int>
+type paramType struct {
+	// regex that the segment must match
+	regex string
+	// convert the value into typed value
+	parse func(value string) (any, error)
+	// schema of the param in the OpenAPI document
+	schema Schema
+}
+
+// layout of the date token
+const dateLayout = "2006-01-02"
+
+// builtin typed constraint tokens
+var paramTypes = map[string]paramType{
+	"int": {
+		regex:  `-?[0-9]+`,
+		parse:  func(s string) (any, error) { return strconv.ParseInt(s, 10, 64) },
+		schema: Schema{"type": "integer", "format": "int64"},
+	},
+	"uint": {
+		regex:  `[0-9]+`,
+		parse:  func(s string) (any, error) { return strconv.ParseUint(s, 10, 64) },
+		schema: Schema{"type": "integer", "minimum": 0},
+	},
+	"float": {
+		regex:  `-?[0-9]+(?:\.[0-9]+)?`,
+		parse:  func(s string) (any, error) { return strconv.ParseFloat(s, 64) },
+		schema: Schema{"type": "number"},
+	},
+	"bool": {
+		regex:  `true|false`,
+		parse:  func(s string) (any, error) { return strconv.ParseBool(s) },
+		schema: Schema{"type": "boolean"},
+	},
+	"uuid": {
+		regex:  `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+		parse:  func(s string) (any, error) { return parseUUID(s) },
+		schema: Schema{"type": "string", "format": "uuid"},
+	},
+	"date": {
+		regex:  `[0-9]{4}-[0-9]{2}-[0-9]{2}`,
+		parse:  func(s string) (any, error) { return time.Parse(dateLayout, s) },
+		schema: Schema{"type": "string", "format": "date"},
+	},
+	"time": {
+		regex:  `[0-9]{4}-[0-9]{2}-[0-9]{2}T[0-9]{2}:[0-9]{2}:[0-9]{2}(?:\.[0-9]+)?(?:Z|[+-][0-9]{2}:[0-9]{2})`,
+		parse:  func(s string) (any, error) { return time.Parse(time.RFC3339, s) },
+		schema: Schema{"type": "string", "format": "date-time"},
+	},
+}
+
+// Return the params captured for the request , nil when the request has no params
+func requestParams(r *http.Request) *routeParams {
+	params, _ := r.Context().Value(contextKey).(*routeParams)
+	return params
+}
+
+// Params return a copy of all captured values of the request , path params in pattern order then the value captured by matchers
+// Optional param that is absent is omitted
+func Params(r *http.Request) []Param {
+	rp := requestParams(r)
+	if rp == nil || len(rp.values) == 0 {
+		return nil
+	}
+
+	return append([]Param(nil), rp.values...)
+}
+
+// Lookup return the captured value of the param and whether it is captured
+// so absent param can be distinguish from the empty one
+// When the same name is captured twice , the value captured by the matcher win
+func Lookup(r *http.Request, key string) (string, bool) {
+	rp := requestParams(r)
+	if rp == nil {
+		return "", false
+	}
+	for i := len(rp.values) - 1; i >= 0; i-- {
+		if rp.values[i].Key == key {
+			return rp.values[i].Value, true
+		}
+	}
+	return "", false
+}
+
+// Return the captured value , wrapped ErrParamNotFound if absent
+func lookupParam(r *http.Request, key string) (string, error) {
+	value, ok := Lookup(r, key)
+	if !ok {
+		return "", fmt.Errorf("%w : %s", ErrParamNotFound, key)
+	}
+	return value, nil
+}
+
+// Return the error when value can not be converted into typ
+func paramTypeError(key, value, typ string, err error) error {
+	return fmt.Errorf("%w : %s=%q is not %s : %w", ErrParamMismatch, key, value, typ, err)
+}
+
+// ParamInt return the param as int
+func ParamInt(r *http.Request, key string) (int, error) {
+	value, err := lookupParam(r, key)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, paramTypeError(key, value, "int", err)
+	}
+	return n, nil
+}
+
+// ParamInt64 return the param as int64
+func ParamInt64(r *http.Request, key string) (int64, error) {
+	value, err := lookupParam(r, key)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, paramTypeError(key, value, "int64", err)
+	}
+	return n, nil
+}
+
+// ParamBool return the param as bool , accept the same value as strconv.ParseBool
+func ParamBool(r *http.Request, key string) (bool, error) {
+	value, err := lookupParam(r, key)
+	if err != nil {
+		return false, err
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, paramTypeError(key, value, "bool", err)
+	}
+	return b, nil
+}
+
+// ParamUUID return the param as 16 bytes UUID , which can be converted into uuid type of other package
+// example : uuid.UUID(id)
+func ParamUUID(r *http.Request, key string) ([16]byte, error) {
+	value, err := lookupParam(r, key)
+	if err != nil {
+		return [16]byte{}, err
+	}
+	id, err := parseUUID(value)
+	if err != nil {
+		return [16]byte{}, paramTypeError(key, value, "uuid", err)
+	}
+	return id, nil
+}
+
+// ParamTime return the param parsed with layout
+// When layout is empty , the layout is decided by the param type : 2006-01-02 for <date> , RFC3339 otherwise
+func ParamTime(r *http.Request, key, layout string) (time.Time, error) {
+	value, err := lookupParam(r, key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if layout == "" {
+		layout = time.RFC3339
+		if requestParams(r).route.paramType(key) == "date" {
+			layout = dateLayout
+		}
+	}
+	t, err := time.Parse(layout, value)
+	if err != nil {
+		return time.Time{}, paramTypeError(key, value, "time", err)
+	}
+	return t, nil
+}
+
+// ParamValue return the param converted according to its typed constraint token
+// int is int64 , uint is uint64 , float is float64 , bool is bool , uuid is [16]byte , date and time is time.Time
+// param without type is return as string
+func ParamValue(r *http.Request, key string) (any, error) {
+	value, err := lookupParam(r, key)
+	if err != nil {
+		return nil, err
+	}
+
+	typ := requestParams(r).route.paramType(key)
+	pt, ok := paramTypes[typ]
+	if !ok {
+		return value, nil
+	}
+	typed, err := pt.parse(value)
+	if err != nil {
+		return nil, paramTypeError(key, value, typ, err)
+	}
+	return typed, nil
+}
+
+// parse canonical UUID such as 123e4567-e89b-12d3-a456-426614174000
+func parseUUID(s string) ([16]byte, error) {
+	var id [16]byte
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return id, errors.New("invalid UUID format")
+	}
+	_, err := hex.Decode(id[:], []byte(strings.ReplaceAll(s, "-", "")))
+	return id, err
+}
+
+// Return the typed constraint token of the path param , empty if the param has no type
+func (rt *Route) paramType(key string) string {
+	for _, p := range rt.params {
+		if p.name == key {
+			return p.typ
+		}
+	}
+	return ""
+}
+
+// Return the param segments of the path in pattern order
+func pathParams(path string) []segment {
+	var params []segment
+	for _, pth := range strings.Split(path, "/")[1:] {
+		seg, err := parseSegment(pth)
+		switch {
+		case err != nil || seg.kind == rankLiteral || seg.kind == rankWildcard && seg.name == "":
+		case seg.parts != nil:
+			for _, part := range seg.parts {
+				if part.kind != rankLiteral {
+					params = append(params, part)
+				}
+			}
+		default:
+			params = append(params, seg)
+		}
+	}
+	return params
+}
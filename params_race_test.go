@@ -0,0 +1,8 @@
+//go:build race
+
+package vi
+
+func init() {
+	// sync.Pool drop items randomly under the race detector , so allocation can not be measured
+	raceEnabled = true
+}
@@ -0,0 +1,172 @@
+package vi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// set when the test is build with the race detector
+var raceEnabled bool
+
+var _ = Describe("Typed params", func() {
+	var (
+		v *vi
+		// run inside the handler , params are only valid until the handler return
+		check func(r *http.Request)
+	)
+	capture := func(w http.ResponseWriter, r *http.Request) {
+		if check != nil {
+			check(r)
+		}
+	}
+	serve := func(method, url string, fn func(r *http.Request)) int {
+		called := false
+		check = func(r *http.Request) {
+			called = true
+			if fn != nil {
+				fn(r)
+			}
+		}
+		rec := httptest.NewRecorder()
+		v.ServeHTTP(rec, httptest.NewRequest(method, url, http.NoBody))
+		Expect(called).To(Equal(rec.Code == http.StatusOK))
+		return rec.Code
+	}
+
+	BeforeEach(func() {
+		v = New(&Config{Banner: false})
+		v.GET("/user/:id<int>/post/:slug<uuid>", capture)
+		v.GET("/report/:day<date>/:at<time>?", capture)
+		v.GET("/flag/:on<bool>/:ratio<float>", capture)
+		v.GET("/search/{term:[a-z]*}/:page?", capture).Host("{tenant}.example.com")
+		v.GET("/static", capture)
+	})
+
+	It("Should constrain matching with the typed token", func() {
+		Expect(serve("GET", "/user/101/post/123e4567-e89b-12d3-a456-426614174000", nil)).To(Equal(http.StatusOK))
+		Expect(serve("GET", "/user/abc/post/123e4567-e89b-12d3-a456-426614174000", nil)).To(Equal(http.StatusNotFound))
+		Expect(serve("GET", "/user/101/post/not-a-uuid", nil)).To(Equal(http.StatusNotFound))
+		Expect(serve("GET", "/report/2024-01-31", nil)).To(Equal(http.StatusOK))
+		Expect(serve("GET", "/report/yesterday", nil)).To(Equal(http.StatusNotFound))
+		Expect(serve("GET", "/flag/yes/1.5", nil)).To(Equal(http.StatusNotFound))
+
+		Ω(func() { v.GET("/bad/:id<decimal>", capture) }).Should(Panic())
+		Ω(func() { v.GET("/bad/:id<int", capture) }).Should(Panic())
+		Ω(func() { v.GET("/bad/:<int>", capture) }).Should(Panic())
+	})
+
+	It("Should return params in pattern order", func() {
+		serve("GET", "http://acme.example.com/search/shoes/2", func(r *http.Request) {
+			Expect(Params(r)).To(Equal([]Param{{"term", "shoes"}, {"page", "2"}, {"tenant", "acme"}}))
+		})
+		serve("GET", "http://acme.example.com/search/shoes", func(r *http.Request) {
+			Expect(Params(r)).To(Equal([]Param{{"term", "shoes"}, {"tenant", "acme"}}))
+		})
+		serve("GET", "/static", func(r *http.Request) {
+			Expect(Params(r)).To(BeEmpty())
+		})
+	})
+
+	It("Should distinguish absent from empty param", func() {
+		serve("GET", "http://acme.example.com/search/", func(r *http.Request) {
+			value, ok := Lookup(r, "term")
+			Expect(ok).To(BeTrue())
+			Expect(value).To(BeEmpty())
+
+			_, ok = Lookup(r, "page")
+			Expect(ok).To(BeFalse())
+			Expect(GetParam(r, "page")).To(BeEmpty())
+		})
+		serve("GET", "/static", func(r *http.Request) {
+			_, ok := Lookup(r, "term")
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	It("Should convert the param with the accessors", func() {
+		serve("GET", "/user/101/post/123e4567-e89b-12d3-a456-426614174000", func(r *http.Request) {
+			Expect(ParamInt(r, "id")).To(Equal(101))
+			Expect(ParamInt64(r, "id")).To(Equal(int64(101)))
+			Expect(ParamUUID(r, "slug")).To(Equal([16]byte{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00}))
+			Expect(ParamValue(r, "id")).To(Equal(int64(101)))
+
+			_, err := ParamInt(r, "slug")
+			Expect(err).To(MatchError(ErrParamMismatch))
+			_, err = ParamBool(r, "id")
+			Expect(err).To(MatchError(ErrParamMismatch))
+			_, err = ParamInt(r, "missing")
+			Expect(err).To(MatchError(ErrParamNotFound))
+		})
+
+		serve("GET", "/flag/true/0.25", func(r *http.Request) {
+			Expect(ParamBool(r, "on")).To(BeTrue())
+			Expect(ParamValue(r, "ratio")).To(Equal(0.25))
+		})
+
+		serve("GET", "/report/2024-01-31/2024-01-31T10:00:00Z", func(r *http.Request) {
+			Expect(ParamTime(r, "day", "")).To(Equal(time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)))
+			Expect(ParamTime(r, "at", "")).To(Equal(time.Date(2024, 1, 31, 10, 0, 0, 0, time.UTC)))
+			Expect(ParamValue(r, "day")).To(Equal(time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)))
+			_, err := ParamTime(r, "day", time.Kitchen)
+			Expect(err).To(MatchError(ErrParamMismatch))
+		})
+
+		serve("GET", "http://acme.example.com/search/shoes", func(r *http.Request) {
+			Expect(ParamValue(r, "term")).To(Equal("shoes"))
+		})
+	})
+
+	It("Should not allocate for static route and allocate constantly for param route", func() {
+		if raceEnabled {
+			Skip("allocation is not stable under the race detector")
+		}
+		check = nil
+		allocs := func(url string) float64 {
+			req := httptest.NewRequest("GET", url, http.NoBody)
+			rec := httptest.NewRecorder()
+			return testing.AllocsPerRun(100, func() { v.ServeHTTP(rec, req) })
+		}
+
+		Expect(allocs("/static")).To(BeZero())
+		one := allocs("/report/2024-01-31")
+		Expect(one).To(BeNumerically("<=", 2), "context and request copy")
+		Expect(allocs("/report/2024-01-31/2024-01-31T10:00:00Z")).To(Equal(one))
+		Expect(allocs("/user/101/post/123e4567-e89b-12d3-a456-426614174000")).To(Equal(one))
+	})
+
+	It("Should not share params between requests", func() {
+		v.GET("/echo/:name", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(GetParam(r, "name")))
+		})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(name string) {
+				defer wg.Done()
+				defer GinkgoRecover()
+				for j := 0; j < 20; j++ {
+					rec := httptest.NewRecorder()
+					v.ServeHTTP(rec, httptest.NewRequest("GET", "/echo/"+name, http.NoBody))
+					Expect(rec.Body.String()).To(Equal(name))
+				}
+			}(strconv.Itoa(i))
+		}
+		wg.Wait()
+	})
+
+	It("Should document the typed token in OpenAPI", func() {
+		params := openAPIPaths("/user/:id<int>/post/:slug<uuid>")[0].params
+		Expect(params[0].Schema).To(Equal(Schema{"type": "integer", "format": "int64"}))
+		Expect(params[1].Schema).To(HaveKeyWithValue("format", "uuid"))
+		Expect(params[1].Schema).To(HaveKey("pattern"))
+		Expect(paramTypes["int"].schema).ToNot(HaveKey("pattern"), "builtin schema should not be modified")
+	})
+})
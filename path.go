@@ -0,0 +1,120 @@
+package vi
+
+import (
+	"net/http"
+	"net/url"
+	ospath "path"
+	"strings"
+)
+
+// PathPolicy decide how request path that is not in the canonical form is handle
+type PathPolicy int
+
+const (
+	// the path must match the registered route exactly
+	PathStrict PathPolicy = iota
+	// redirect to the canonical path , 301 for GET and HEAD , 308 for other methods so the method and body are preserved
+	PathRedirect
+	// serve the canonical path transparently , handler see the canonical path in r.URL.Path
+	PathServe
+)
+
+// Return the path use for routing , which is the raw path when it is enabled and set
+// raw is true when the raw path is use , so the params are decoded before matching
+func (v *vi) routingPath(r *http.Request) (path string, raw bool) {
+	if v.rawpath && r.URL.RawPath != "" {
+		return r.URL.RawPath, true
+	}
+	return r.URL.Path, false
+}
+
+// Clean the path by resolving . and .. and removing duplicate slashes , the trailing slash is kept
+// path that is already clean is return as is without allocation
+func cleanPath(p string) string {
+	if p == "" || p[0] != '/' {
+		p = "/" + p
+	}
+
+	cleaned := ospath.Clean(p)
+	if cleaned != "/" && strings.HasSuffix(p, "/") {
+		if len(p) == len(cleaned)+1 && strings.HasPrefix(p, cleaned) {
+			return p
+		}
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// Return the path with the trailing slash added or removed
+func toggleSlash(p string) string {
+	if strings.HasSuffix(p, "/") {
+		return p[:len(p)-1]
+	}
+	return p + "/"
+}
+
+// whether there is route that serve the request at path
+func (v *vi) exists(t *table, r *http.Request, path string, raw bool) bool {
+	rp := paramsPool.Get().(*routeParams)
+	defer rp.release()
+
+	route := v.resolve(t, r, path, raw, &rp.values)
+	return route != nil
+}
+
+// find the route that serve the request at path when static segments are compare case insensitively
+// canonical is the path with static segments in the registered casing
+func (v *vi) fold(t *table, r *http.Request, path string, raw bool) (route *Route, canonical string) {
+	rp := paramsPool.Get().(*routeParams)
+	defer rp.release()
+
+	if tree, ok := t.trees[r.Method]; ok {
+		route, canonical = tree.lookupFold(r, path, raw, &rp.values)
+	}
+	if route == nil && r.Method == http.MethodHead && v.autohead {
+		if tree, ok := t.trees[http.MethodGet]; ok {
+			rp.values = rp.values[:0]
+			route, canonical = tree.lookupFold(r, path, raw, &rp.values)
+		}
+	}
+	if route == nil {
+		if tree, ok := t.trees[methodAny]; ok {
+			rp.values = rp.values[:0]
+			route, canonical = tree.lookupFold(r, path, raw, &rp.values)
+		}
+	}
+
+	return route, canonical
+}
+
+// fix the request to path according to the policy , path is in the same form as the routing path
+func (v *vi) fixPath(w http.ResponseWriter, r *http.Request, path string, raw bool, policy PathPolicy) {
+	u := *r.URL
+	u.Path, u.RawPath = path, ""
+	if raw {
+		if unescaped, err := url.PathUnescape(path); err == nil {
+			u.Path, u.RawPath = unescaped, path
+		}
+	}
+
+	if policy == PathRedirect {
+		// the redirect is relative to where the router is mounted
+		if prefix := mountPrefix(r); prefix != "" {
+			if u.RawPath != "" {
+				u.RawPath = (&url.URL{Path: prefix}).EscapedPath() + u.RawPath
+			}
+			u.Path = prefix + u.Path
+		}
+		code := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			code = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, u.String(), code)
+		return
+	}
+
+	next := new(http.Request)
+	*next = *r
+	next.URL = &u
+	v.ServeHTTP(w, next)
+}
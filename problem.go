@@ -0,0 +1,58 @@
+package vi
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Problem is the RFC 7807 problem detail , use to report the request that does not match the API contract
+type Problem struct {
+	// URI that identify the problem type , default to about:blank
+	Type string `json:"type"`
+	// Short summary of the problem , default to the status text
+	Title string `json:"title"`
+	// HTTP status of the response
+	Status int `json:"status"`
+	// Explanation specific to this occurrence of the problem
+	Detail string `json:"detail,omitempty"`
+	// URI of the request that cause the problem , default to the request path
+	Instance string `json:"instance,omitempty"`
+	// Extension member , each invalid param or body field
+	Errors []ProblemError `json:"errors,omitempty"`
+}
+
+// ProblemError describe single invalid part of the request
+type ProblemError struct {
+	// one of path , query , header , cookie or body
+	In string `json:"in"`
+	// name of the param , or JSON pointer of the body field
+	Name string `json:"name,omitempty"`
+	// what is wrong with the value
+	Detail string `json:"detail"`
+}
+
+// Write the problem as application/problem+json response
+func (p *Problem) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	problem := *p
+	if problem.Type == "" {
+		problem.Type = "about:blank"
+	}
+	if problem.Status == 0 {
+		problem.Status = http.StatusInternalServerError
+	}
+	if problem.Title == "" {
+		problem.Title = http.StatusText(problem.Status)
+	}
+	if problem.Instance == "" && r != nil {
+		problem.Instance = r.URL.Path
+	}
+
+	body, err := json.Marshal(problem)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(problem.Status)
+	w.Write(body)
+}
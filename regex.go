@@ -1,12 +1,11 @@
 package vi
 
 import (
-	"bytes"
 	"fmt"
+	neturl "net/url"
 	"regexp"
 	"strings"
 	"sync"
-	"unicode"
 
 	. "github.com/diontr00/vi/internal/color"
 )
@@ -17,19 +16,24 @@ var helperPattern = map[string]string{
 	"default": `[\w]+`,
 }
 
-var regexCache = map[string]*regexp.Regexp{}
-var regexRW sync.RWMutex
+// guard helperPattern , since helper can be register while routing
+var helperRW sync.RWMutex
+
+// match string that contain no meta character
+var nonMetaRegex = regexp.MustCompile(`^[a-zA-Z0-9{}]+$`)
 
 // Use to register global helper pattern to be use in param matching
 // example : ip ,`\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}`
 // then you can use something like  v.Get("/location/:ip", ...)
 func RegisterHelper(pattern, regex string) {
+	helperRW.Lock()
+	defer helperRW.Unlock()
+
 	helperPattern[pattern] = regex
 }
 
 type (
 	matchKey string
-	helper   string
 	// Match param store the params matched.
 	matchParams = map[matchKey]string
 )
@@ -41,22 +45,22 @@ type ExpectMatch map[string]string
 type TestUrl string
 
 // Can be use to validate whether the regex pattern match correctly
+// The url match only when the whole url match the pattern , and the captured params are exactly the expected one
 func TestMatcher(expect bool, pattern string, tests ...map[TestUrl]ExpectMatch) []error {
 	var errs []error
 	for i := range tests {
 		for url, result := range tests[i] {
 			matched, params := match(string(url), pattern)
-			var matchResult = false
-			// loop match param key and value
+			exact := matched && len(params) == len(result)
 			for k, v := range result {
-				if pv, ok := params[matchKey(k)]; ok || v == pv {
-					matchResult = true
+				if pv, ok := params[matchKey(k)]; !ok || pv != v {
+					exact = false
 					break
 				}
 			}
 
-			if matched != expect || matchResult != expect {
-				msg := Red("Got %t and %v when match %s and %s \n", matched, params, url, pattern)
+			if exact != expect {
+				msg := Red("Got %t and %v when match %s and %s , expect %v \n", matched, params, url, pattern, result)
 				errs = append(errs, fmt.Errorf("%s", msg))
 			}
 		}
@@ -67,196 +71,520 @@ func TestMatcher(expect bool, pattern string, tests ...map[TestUrl]ExpectMatch)
 	return errs
 }
 
-// Match route path again the url
-// Should be use after perform static full path match
+// Match route path again the url with the same semantics as routing
+// The pattern must match the whole url and each param is bounded by the segment , unless it is spanning param
 // Return whether match , and the map of param and its value.
 func match(url, path string) (matched bool, results matchParams) {
-	path = strings.Trim(path, " ")
-	if path == "" {
+	if path == "" || path[0] != '/' {
 		return false, nil
 	}
 
-	paths := strings.Split(path, "/")
-	// empty path
-	if len(paths) == 1 {
+	t := newTree()
+	if err := t.add(path, &Route{path: path}); err != nil {
 		return false, nil
 	}
+
+	var params []Param
+	rt := t.lookup(nil, url, false, &params)
+	return rt != nil, toParams(params)
+}
+
+// convert captured params into matchParams , nil if nothing captured
+func toParams(params []Param) matchParams {
+	if len(params) == 0 {
+		return nil
+	}
+
+	result := make(matchParams, len(params))
+	for _, p := range params {
+		result[matchKey(p.Key)] = p.Value
+	}
+	return result
+}
+
+// segment is the parsed form of a path segment
+type segment struct {
+	// one of the rank constant
+	kind int
+	// literal text or param name
+	name string
+	// regex of the param
+	regex string
+	// modifier of the param , such as ? or *
+	modifier byte
+	// param can span multiple segments
+	span bool
+	// typed constraint token of the param , such as int
+	typ string
+	// literal and param parts of segment that mix literal text and params , such as :name.:ext
+	parts []segment
+	// compiled form of the mixed segment , capture all of its params at once
+	tpl *template
+}
+
+// Parse single path segment
+func parseSegment(pth string) (segment, error) {
+	if pth == "" {
+		return segment{kind: rankLiteral}, nil
+	}
+	if isMixed(pth) {
+		return parseMixed(pth)
+	}
+	firstCh := pth[0]
+	lastCh := pth[len(pth)-1]
+
+	switch {
+	case pth == "*":
+		// Only wildcard is treated as regex when represent as standalone value in path.
+		return segment{kind: rankWildcard}, nil
+	case firstCh == '*' && isWord(pth[1:]):
+		// named catch all , capture the rest of the path
+		return segment{kind: rankWildcard, name: pth[1:], regex: ".+"}, nil
+	case firstCh == '{' && lastCh == '}':
+		// named:regex
+		ptrns := strings.SplitN(pth[1:len(pth)-1], ":", 2)
+		seg := segment{kind: rankRegex, name: ptrns[0], regex: ptrns[0]}
+		// name... signify the param can cross / , which has the same priority as param with modifier
+		if name, ok := strings.CutSuffix(seg.name, "..."); ok {
+			seg = segment{kind: rankOptional, name: name, regex: ".+", span: true}
+			if name == "" {
+				return seg, fmt.Errorf("empty param name in %s", pth)
+			}
+		}
+		if len(ptrns) == 2 {
+			seg.regex = ptrns[1]
+		} else if seg.name == "" {
+			return seg, fmt.Errorf("empty regex in %s", pth)
+		}
+		return seg, nil
+	case firstCh == ':' && len(pth) > 1:
+		param := pth[1:]
+		var modifier byte
+		// Whether the last char is not alpha numeric , which signify regex modifier.
+		if isMeta(string(lastCh)) && lastCh != '>' {
+			if lastCh != '?' && lastCh != '*' && lastCh != '+' {
+				return segment{}, fmt.Errorf("invalid modifier %c in %s", lastCh, pth)
+			}
+			modifier = lastCh
+			param = param[:len(param)-1]
+		}
+
+		seg := segment{kind: rankParam, name: param, regex: helperRegex(param)}
+		if start := strings.IndexByte(param, '<'); start >= 0 {
+			// typed constraint token , such as :id<int>
+			if param[len(param)-1] != '>' || start == 0 {
+				return segment{}, fmt.Errorf("invalid typed param %s", pth)
+			}
+			typ := param[start+1 : len(param)-1]
+			pt, ok := paramTypes[typ]
+			if !ok {
+				return segment{}, fmt.Errorf("unknown param type %s in %s", typ, pth)
+			}
+			seg = segment{kind: rankRegex, name: param[:start], regex: pt.regex, typ: typ}
+		} else if hasHelper(param) {
+			seg.kind = rankRegex
+		}
+
+		if modifier != 0 {
+			seg.kind = rankOptional
+			seg.modifier = modifier
+		}
+		return seg, nil
+	default:
+		// Other meta char should be treated as normal word by escape them.
+		return segment{kind: rankLiteral, name: pth}, nil
+	}
+}
+
+// whether the segment mix literal text and params , such as :name.:ext , v:version , @:handle or {name:[a-z]+}.png
+// single param followed by one character is not mixed , the character is the modifier
+func isMixed(pth string) bool {
+	for i := 0; i < len(pth); i++ {
+		switch {
+		case pth[i] == '{':
+			end := closingBrace(pth, i)
+			return end >= 0 && (i > 0 || end != len(pth)-1)
+		case paramStart(pth, i):
+			if i > 0 {
+				return true
+			}
+			n := paramEnd(pth, i)
+			if strings.HasPrefix(pth[n:], "<") {
+				if end := strings.IndexByte(pth[n:], '>'); end >= 0 {
+					n += end + 1
+				}
+			}
+			return len(pth)-n > 1
+		}
+	}
+	return false
+}
+
+// Parse segment that mix literal text and params , each param match part of the segment
+// param name of :name end at the first non word character
+func parseMixed(pth string) (segment, error) {
 	var (
-		// Names of matched param in pattern.
-		matchName = []string{}
-		// Regex pattern holder to match again url.
-		tmp strings.Builder
+		seg = segment{kind: rankRegex, name: pth}
+		tpl strings.Builder
 	)
 
-	for i, pth := range paths {
-		if pth != "" {
-			// Byte represent ation of path.
-			pthB := []byte(pth)
-			lastIdx := len(pthB) - 1
-
-			firstCh := string(pthB[0])
-			lastCh := string(pthB[lastIdx])
-
-			// Check first path
-			// 0 should be empty. "for /".
-			if i == 1 {
-				if firstCh == "*" {
-					// Only wildcard is treated as regex when represent as standalone value in path.
-					if len(pth) == 1 {
-						matched = true
-						// Return nil insteead of empty map , since map all.
-						results = nil
-						return
-					}
+	for rest := pth; rest != ""; {
+		var part segment
+		switch {
+		case rest[0] == '{':
+			end := closingBrace(rest, 0)
+			if end < 0 {
+				return segment{}, fmt.Errorf("unbalanced curly bracket in %s", pth)
+			}
+			ptrns := strings.SplitN(rest[1:end], ":", 2)
+			part = segment{kind: rankRegex, name: ptrns[0], regex: helperRegex("default")}
+			if len(ptrns) == 2 {
+				part.regex = ptrns[1]
+			}
+			rest = rest[end+1:]
+		case paramStart(rest, 0):
+			n := paramEnd(rest, 0)
+			name := rest[1:n]
+			part = segment{kind: rankParam, name: name, regex: helperRegex(name)}
+			if hasHelper(name) {
+				part.kind = rankRegex
+			}
+			rest = rest[n:]
+
+			if strings.HasPrefix(rest, "<") {
+				end := strings.IndexByte(rest, '>')
+				if end < 0 {
+					return segment{}, fmt.Errorf("invalid typed param %s", pth)
 				}
-				// Other meta char should be treated as normal word by escape them.
-				if isMeta(firstCh) {
-					if len(pth) == 1 {
-						tmp.WriteString("/")
-						tmp.WriteString(escapeNonAlphaNum(pth))
-						continue
-					}
+				pt, ok := paramTypes[rest[1:end]]
+				if !ok {
+					return segment{}, fmt.Errorf("unknown param type %s in %s", rest[1:end], pth)
 				}
+				part = segment{kind: rankRegex, name: name, regex: pt.regex, typ: rest[1:end]}
+				rest = rest[end+1:]
 			}
+			if rest != "" && strings.IndexByte("?*+", rest[0]) >= 0 {
+				return segment{}, fmt.Errorf("modifier %c is not supported in mixed segment %s", rest[0], pth)
+			}
+		default:
+			n := 1
+			for n < len(rest) && rest[n] != '{' && !paramStart(rest, n) {
+				n++
+			}
+			part = segment{kind: rankLiteral, name: rest[:n]}
+			rest = rest[n:]
+		}
 
-			if firstCh == "{" && lastCh == "}" {
-				// named:regex
-				ptrns := bytes.Split(pthB[1:lastIdx], []byte(":"))
-				param := string(ptrns[0])
-
-				matchName = append(matchName, param)
-				var regex string
-				l := len(ptrns)
-				switch {
-				case l == 2 || l > 2:
-					regex = string(ptrns[1])
-				default:
-					if param == "" {
-						return false, nil
-					}
-					regex = param
-				}
+		if part.kind == rankLiteral {
+			tpl.WriteString(part.name)
+		} else {
+			if part.name == "" {
+				return segment{}, fmt.Errorf("empty param name in %s", pth)
+			}
+			tpl.WriteString("{" + part.name + ":" + part.regex + "}")
+		}
+		seg.parts = append(seg.parts, part)
+	}
+
+	t, err := compileTemplate(tpl.String(), "")
+	if err != nil {
+		return segment{}, err
+	}
+	seg.tpl = t
+	seg.regex = strings.TrimSuffix(strings.TrimPrefix(t.regex.String(), "^"), "$")
+	return seg, nil
+}
+
+// whether :name param start at i
+func paramStart(s string, i int) bool {
+	if s[i] != ':' || i+1 >= len(s) {
+		return false
+	}
+	c := s[i+1]
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// Return the index after the name of :name param start at i
+func paramEnd(s string, i int) int {
+	n := i + 1
+	for n < len(s) && isWordByte(s[n]) {
+		n++
+	}
+	return n
+}
+
+// whether s is non empty and contain only word character
+func isWord(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isWordByte(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
 
-				tmp.WriteString("/")
-				tmp.WriteString("(")
-				tmp.WriteString(string(regex))
-				tmp.WriteString(")")
-			} else if firstCh == ":" {
-				pattern := string(pthB)
-				// :named.
-				patterns := strings.Split(pattern, ":")
-				// named
-				param := patterns[1]
-				paramLastIdx := len(param) - 1
-				paramLastChar := []byte(param)[paramLastIdx]
-				// Whether the last char is alpha numeric , which signify regex modifier.
-				if isMeta(string(paramLastChar)) {
-					// [name , specialChar ].
-					matchName = append(matchName, param[0:paramLastIdx])
-					tmp.WriteString(patternGen(strings.TrimSuffix(param, string(paramLastChar)), true))
-					// Add modifier to regex string.
-					tmp.WriteString(string(paramLastChar))
+// Build the url from route path by substitute each param with its value
+// Each value must match the param regex , optional param will be omit when value not provide
+func buildURL(path string, values map[string]string) (string, error) {
+	var url strings.Builder
+
+	segs := strings.Split(strings.Trim(path, " "), "/")
+	for i, pth := range segs {
+		// empty segment such as the trailing slash is kept , since the path policy may be strict
+		if pth == "" {
+			if i > 0 {
+				url.WriteString("/")
+			}
+			continue
+		}
+
+		seg, err := parseSegment(pth)
+		if err != nil {
+			return "", fmt.Errorf("%w : %w", ErrParamMismatch, err)
+		}
+
+		switch {
+		case seg.kind == rankWildcard && seg.name == "":
+			return "", fmt.Errorf("%w : wildcard in %s cannot be build", ErrMissingParam, path)
+		case seg.kind == rankLiteral:
+			url.WriteString("/" + seg.name)
+			continue
+		case seg.parts != nil:
+			url.WriteString("/")
+			for _, part := range seg.parts {
+				if part.kind == rankLiteral {
+					url.WriteString(part.name)
 					continue
 				}
+				value, err := buildValue(path, part, values)
+				if err != nil {
+					return "", err
+				}
+				url.WriteString(value)
+			}
+			continue
+		}
 
-				matchName = append(matchName, patterns[1])
-				tmp.WriteString(patternGen(patterns[1], false))
-			} else {
-				// Handle non define pattern case , escape all.
-				tmp.WriteString("/" + escapeNonAlphaNum(pth))
+		if _, ok := values[seg.name]; !ok {
+			// trailing catch all can match nothing
+			if seg.modifier == '?' || seg.modifier == '*' || seg.kind == rankWildcard && i == len(segs)-1 {
+				continue
 			}
 		}
+		value, err := buildValue(path, seg, values)
+		if err != nil {
+			return "", err
+		}
+		url.WriteString("/" + value)
 	}
 
-	return regexHelper(url, tmp.String(), matchName)
+	if url.Len() == 0 {
+		return "/", nil
+	}
+	return url.String(), nil
 }
 
-// Generate regrex pattern for s
-// If group is true , the  pattern  is  prefix with / before capture , when we want to apply modifier to the pattern  like optional.
-func patternGen(s string, group bool) string {
-	var pattern strings.Builder
-	pattern.WriteString("(")
-	if group {
-		pattern.WriteString("/")
+// Return the escaped value of the param to build the url , which must be provided and match the param regex
+// / is kept for catch all and spanning param , since their value can contain multiple segments
+func buildValue(path string, seg segment, values map[string]string) (string, error) {
+	value, ok := values[seg.name]
+	if !ok {
+		return "", fmt.Errorf("%w : %s is required by %s", ErrMissingParam, seg.name, path)
 	}
 
-	if p, ok := helperPattern[s]; ok {
-		pattern.WriteString(p)
-	} else {
-		pattern.WriteString(helperPattern["default"])
+	re, err := regexp.Compile("^(?:" + seg.regex + ")$")
+	if err != nil {
+		return "", fmt.Errorf("%w : invalid pattern %s for %s : %w", ErrParamMismatch, seg.regex, seg.name, err)
+	}
+	if !re.MatchString(value) {
+		return "", fmt.Errorf("%w : %s=%q not match %s", ErrParamMismatch, seg.name, value, seg.regex)
 	}
 
-	pattern.WriteString(")")
-	if group {
-		return pattern.String()
+	if seg.span || seg.kind == rankWildcard {
+		parts := strings.Split(value, "/")
+		for i, part := range parts {
+			parts[i] = neturl.PathEscape(part)
+		}
+		return strings.Join(parts, "/"), nil
 	}
-	return "/" + pattern.String()
+	return neturl.PathEscape(value), nil
 }
 
-// Regex matching of url  again generated pattern.
-func regexHelper(url, pattern string, matchedName []string) (matched bool, result map[matchKey]string) {
-	result = make(map[matchKey]string, len(matchedName))
-
-	regexRW.RLock()
-	defer regexRW.RUnlock()
-	var r *regexp.Regexp
-	if rc, ok := regexCache[pattern]; !ok {
-		r = regexp.MustCompile(pattern)
-		go func(regex *regexp.Regexp) {
-			defer regexRW.Unlock()
-			regexRW.Lock()
-			regexCache[pattern] = regex
-		}(r)
-	} else {
-		r = rc
+// whether helper other than default is registered with name s
+func hasHelper(s string) bool {
+	helperRW.RLock()
+	defer helperRW.RUnlock()
+
+	_, ok := helperPattern[s]
+	return ok && s != "default"
+}
+
+// Get the regex of the registered helper , or the default pattern if not registered
+func helperRegex(s string) string {
+	helperRW.RLock()
+	defer helperRW.RUnlock()
+
+	if p, ok := helperPattern[s]; ok {
+		return p
 	}
+	return helperPattern["default"]
+}
 
-	submatch := r.FindSubmatch([]byte(url))
+// template is the compiled form of text contain {name} or {name:regex}
+type template struct {
+	regex *regexp.Regexp
+	// name of each param in order
+	names []string
+	// submatch index of each param , since user regex can contain its own group
+	groups []int
+}
 
-	if submatch != nil {
-		submatch = submatch[1:]
-		for i, match := range submatch {
-			if i > len(matchedName)-1 {
-				break
-			}
-			if len(match) == 0 {
-				continue
-			}
+// Compile template into anchored regex , text outside of curly bracket is match literally
+// Param without regex will use the defaultRegex
+func compileTemplate(tpl, defaultRegex string) (*template, error) {
+	var (
+		pattern strings.Builder
+		t       = new(template)
+		group   = 1
+	)
 
-			key := matchedName[i]
-			if string(match[0]) == "/" {
-				match = match[1:]
-			}
-			result[matchKey(key)] = string(match)
+	pattern.WriteString("^")
+	for len(tpl) > 0 {
+		start := strings.IndexByte(tpl, '{')
+		if start < 0 {
+			pattern.WriteString(regexp.QuoteMeta(tpl))
+			break
+		}
+
+		end := closingBrace(tpl, start)
+		if end < 0 {
+			return nil, fmt.Errorf("unbalanced curly bracket in %s", tpl)
+		}
+
+		ptrns := strings.SplitN(tpl[start+1:end], ":", 2)
+		if ptrns[0] == "" {
+			return nil, fmt.Errorf("empty param name in %s", tpl)
 		}
-		if len(result) == 0 {
-			result = nil
+		regex := defaultRegex
+		if len(ptrns) == 2 {
+			regex = ptrns[1]
 		}
-		matched = true
-		return
+
+		sub, err := regexp.Compile(regex)
+		if err != nil {
+			return nil, err
+		}
+
+		pattern.WriteString(regexp.QuoteMeta(tpl[:start]))
+		pattern.WriteString("(")
+		pattern.WriteString(regex)
+		pattern.WriteString(")")
+
+		t.names = append(t.names, ptrns[0])
+		t.groups = append(t.groups, group)
+		group += 1 + sub.NumSubexp()
+		tpl = tpl[end+1:]
+	}
+	pattern.WriteString("$")
+
+	regex, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return nil, err
 	}
-	result = nil
-	matched = false
-	return
+	t.regex = regex
+
+	return t, nil
 }
 
-// Check whether the string  contain meta character , that not curly bracket to signify regex pattern.
-func isMeta(s string) bool {
-	re := regexp.MustCompile(`^[a-zA-Z0-9{}]+$`)
-	match := re.FindSubmatch([]byte(s))
+// Match s against template and append the captured value to params
+func (t *template) capture(s string, params *[]Param) bool {
+	submatch := t.regex.FindStringSubmatch(s)
+	if submatch == nil {
+		return false
+	}
 
-	return len(match) == 0
+	for i, name := range t.names {
+		*params = append(*params, Param{Key: name, Value: submatch[t.groups[i]]})
+	}
+	return true
 }
 
-// Escape all non alpha numeric in the string.
-func escapeNonAlphaNum(s string) string {
-	var buffer bytes.Buffer
-	for _, char := range s {
-		if unicode.IsLetter(char) || unicode.IsDigit(char) {
-			buffer.WriteRune(char)
-		} else {
-			buffer.WriteString(fmt.Sprintf("\\%c", char))
+// Return the index of curly bracket that close the one at start , -1 if not found
+func closingBrace(s string, start int) int {
+	depth := 0
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Specificity of path segment , use to decide which route get match first
+const (
+	// literal text
+	rankLiteral = iota
+	// {name:regex} or param with registered helper
+	rankRegex
+	// param with default pattern
+	rankParam
+	// param with modifier , or param that span multiple segments
+	rankOptional
+	// standalone or named catch all
+	rankWildcard
+)
+
+// Return the rank of each segment in the path
+func rankPath(path string) []int {
+	paths := strings.Split(path, "/")[1:]
+	ranks := make([]int, len(paths))
+	for i, pth := range paths {
+		ranks[i] = rankSegment(pth)
+	}
+	return ranks
+}
+
+// whether the route with rank a is match before the route with rank b , segment are compare from the start
+// and route that end first is match before the param that can match zero segment
+func moreSpecific(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// Rank the path segment , invalid segment is treated as literal
+func rankSegment(pth string) int {
+	seg, _ := parseSegment(pth)
+	return seg.kind
+}
+
+// whether all segments are literal
+func isStaticRank(rank []int) bool {
+	for _, r := range rank {
+		if r != rankLiteral {
+			return false
 		}
 	}
-	return buffer.String()
+	return true
+}
+
+// Check whether the string  contain meta character , that not curly bracket to signify regex pattern.
+func isMeta(s string) bool {
+	return !nonMetaRegex.MatchString(s)
 }
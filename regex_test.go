@@ -28,7 +28,22 @@ var _ = DescribeTable("Regex: Unit-test", func(url string, path string, result b
 },
 	Entry("Should match correctly simple named params", "/dion", "/:name", true, map[matchKey]string{"name": "dion"}),
 	Entry("Should match optional modifiers with return values", "/user/dion/1234/vietnam", "/user/:name/1234/:nationality?", true, map[matchKey]string{"name": "dion", "nationality": "vietnam"}),
-	Entry("Should match optional modifier with no return values", "/video/:title", "/video", true, nil),
+	Entry("Should match optional modifier with no return values", "/video", "/video/:title?", true, nil),
+	Entry("Should match the whole path", "/api/user/12/extra", "/user/:id", false, nil),
+	Entry("Should not match trailing segment", "/user/12/extra", "/user/:id", false, nil),
+	Entry("Should bound regex param by segment", "/file/a/b.js", `/file/{name:.+\.js}`, false, nil),
+	Entry("Should match spanning param", "/file/a/b.js", `/file/{name...:.+\.js}`, true, map[matchKey]string{"name": "a/b.js"}),
+	Entry("Should match spanning param in the middle", "/repo/a/b/blob/main", "/repo/{name...}/blob/:ref", true, map[matchKey]string{"name": "a/b", "ref": "main"}),
+	Entry("Should not match spanning param with empty segment", "/repo/blob/main", "/repo/{name...}/blob/:ref", false, nil),
+	Entry("Should capture the rest with named catch all", "/files/a/b.txt", "/files/*path", true, map[matchKey]string{"path": "a/b.txt"}),
+	Entry("Should capture empty rest with named catch all", "/files", "/files/*path", true, map[matchKey]string{"path": ""}),
+	Entry("Should match named catch all in the middle", "/repo/a/b/raw/main", "/repo/*path/raw/:ref", true, map[matchKey]string{"path": "a/b", "ref": "main"}),
+	Entry("Should not match catch all in the middle with empty segment", "/repo/raw/main", "/repo/*path/raw/:ref", false, nil),
+	Entry("Should match mixed segment", "/img/photo.png", "/img/:name.:ext", true, map[matchKey]string{"name": "photo", "ext": "png"}),
+	Entry("Should match mixed segment with literal prefix", "/v2/users", "/v:version/users", true, map[matchKey]string{"version": "2"}),
+	Entry("Should match mixed segment with symbol", "/@anh", "/@:handle", true, map[matchKey]string{"handle": "anh"}),
+	Entry("Should match mixed segment with regex and typed param", "/page-3/photo.png", "/page-:n<int>/{name:[a-z]+}.png", true, map[matchKey]string{"n": "3", "name": "photo"}),
+	Entry("Should not match mixed segment without literal", "/img/photo", "/img/:name.:ext", false, nil),
 	Entry("Should match star modifiers", "/user/dion/1234", "/user/:name/:id*", true, map[matchKey]string{"name": "dion", "id": "1234"}),
 	Entry("Should match regex pattern", "/employee/153/accounting", "/employee/{uid:[0-9]+}/{department:[a-zA-Z]+}", true, map[matchKey]string{"uid": "153", "department": "accounting"}),
 	Entry("Should match helper pattern", "/user/dion/1234", "/user/:name/:id", true, map[matchKey]string{"name": "dion", "id": "1234"}),
@@ -57,17 +72,20 @@ var _ = DescribeTable("Check isMeta return true only if string contain meta char
 	Entry("", "^*?", true),
 )
 
-var _ = DescribeTable("Test escapeMeta to escape all the meta character in the string", func(input string, expected string) {
-	result := escapeNonAlphaNum(input)
-	Expect(result).To(Equal(expected), "for input %s, expected %s , but got %s")
-
-},
+var _ = Describe("Pattern matching", func() {
+	It("Should capture correct value when param regex contain its own group", func() {
+		matched, params := match("/phone/12-34/anh", `/phone/{num:(\d+)-(\d+)}/:name`)
+		Expect(matched).To(BeTrue())
+		Expect(params).To(Equal(matchParams{"num": "12-34", "name": "anh"}))
+	})
 
-	Entry("", "abc123", "abc123"),
-	Entry("", "abc$123", "abc\\$123"),
-	Entry("", "", ""),
-	Entry("", "1@2#3$4", "1\\@2\\#3\\$4"),
-)
+	It("Should not match invalid pattern", func() {
+		for _, path := range []string{"", "!", "/{}", "/{id:[0-9}", "/{...}", "/*/a", "/a/*rest/:id?", "/a/*rest/*more", "/img/:name?.png"} {
+			matched, _ := match("/anything", path)
+			Expect(matched).To(BeFalse(), "pattern %q should be invalid", path)
+		}
+	})
+})
 
 var _ = Describe("Test pattern register", func() {
 	It("Should matched correctly and return associate params", func() {
@@ -112,4 +130,21 @@ var _ = Describe("TestMatcher", func() {
 
 	})
 
+	It("Test expect exact captures", func() {
+		errs := TestMatcher(true, "/user/:name/:id?", map[TestUrl]ExpectMatch{
+			"/user/anh/101": {"name": "anh", "id": "101"},
+			"/user/anh":     {"name": "anh"},
+		})
+		Expect(errs).To(BeNil())
+
+		errs = TestMatcher(true, "/user/:name/:id?", map[TestUrl]ExpectMatch{
+			"/user/anh/101":  {"name": "anh", "id": "102"},
+			"/user/dion":     {"name": "anh"},
+			"/user/anh/101/": {"name": "anh", "id": "101"},
+			"/user/anh/102":  {"name": "anh"},
+			"/api/user/anh":  {"name": "anh"},
+		})
+		Expect(errs).To(HaveLen(5), "wrong , missing or extra capture should fail")
+	})
+
 })
@@ -0,0 +1,152 @@
+package vi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/diontr00/vi/internal/color"
+)
+
+var (
+	// Return by URL when there is no route register with the name , or by Remove and Replace when there is no route along the path
+	ErrRouteNotFound = errors.New("route not found")
+	// Return by URL when the required param value is not provide
+	ErrMissingParam = errors.New("missing param")
+	// Return by URL when the param value not match the param pattern
+	ErrParamMismatch = errors.New("param does not match pattern")
+)
+
+// Route represent a registered route
+type Route struct {
+	// http method of the route
+	method string
+	// the route pattern
+	path string
+	// name of the route , empty when anonymous
+	name string
+	// the handler for the route , can be replace while serving request
+	handler atomic.Pointer[http.HandlerFunc]
+	// param segments of the path in pattern order
+	params []segment
+	// rank of each segment of the path
+	rank []int
+	// middleware scope of the group the route registered under
+	scope *scope
+	// middlewares of the route only , run after the middlewares of the scope
+	middlewares []middleware
+	// the handler chained with all middlewares , rebuild when the handler or the middlewares change
+	chain atomic.Pointer[http.HandlerFunc]
+	// policy for path that differ by the casing of static segments
+	casepolicy PathPolicy
+	// extra conditions beside method and path that request must satisfy
+	// publish atomically , since it can be read by request while route being configured
+	matchers atomic.Pointer[[]matcher]
+	// user metadata of the route , guard by the router lock
+	meta Metadata
+	// the router that the route registered with
+	router *router
+}
+
+// Name the route , so the url of the route can be build with URL
+// Panic if the name already been use by another route
+func (rt *Route) Name(name string) *Route {
+	if name == "" {
+		panic(color.Red("route name must not be empty"))
+	}
+
+	rt.router.update(func(t *table) {
+		if _, ok := t.named[name]; ok {
+			panic(color.Red("route name %s already registered", name))
+		}
+		if rt.name != "" {
+			delete(t.named, rt.name)
+		}
+
+		rt.name = name
+		t.named[name] = rt
+	})
+	return rt
+}
+
+// Get the name of the route
+func (rt *Route) GetName() string {
+	rt.router.mu.Lock()
+	defer rt.router.mu.Unlock()
+
+	return rt.name
+}
+
+// Get the pattern of the route
+func (rt *Route) GetPath() string {
+	return rt.path
+}
+
+// Get the method of the route
+func (rt *Route) GetMethod() string {
+	return rt.method
+}
+
+// return the current handler of the route
+func (rt *Route) loadHandler() http.HandlerFunc {
+	return *rt.handler.Load()
+}
+
+// return the handler chained with the middlewares
+func (rt *Route) loadChain() http.HandlerFunc {
+	return *rt.chain.Load()
+}
+
+// match whether the request satisfy all of route matchers , captured value is appended to params
+func (rt *Route) match(r *http.Request, params *[]Param) bool {
+	for _, m := range rt.loadMatchers() {
+		if !m.match(r, params) {
+			return false
+		}
+	}
+	return true
+}
+
+// return the current matchers of the route
+func (rt *Route) loadMatchers() []matcher {
+	if m := rt.matchers.Load(); m != nil {
+		return *m
+	}
+	return nil
+}
+
+// publish new matchers list with m appended
+func (rt *Route) addMatcher(m matcher) {
+	rt.router.mu.Lock()
+	defer rt.router.mu.Unlock()
+
+	matchers := append(append([]matcher(nil), rt.loadMatchers()...), m)
+	rt.matchers.Store(&matchers)
+}
+
+// URL build the url for the route , pairs is the list of param name and value
+// example : r.URL("id", "101", "name", "anh")
+func (rt *Route) URL(pairs ...string) (string, error) {
+	if len(pairs)%2 != 0 {
+		return "", fmt.Errorf("%w : params must be pairs of name and value , got %d values", ErrMissingParam, len(pairs))
+	}
+
+	values := make(map[string]string, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		values[pairs[i]] = pairs[i+1]
+	}
+
+	return buildURL(rt.path, values)
+}
+
+// URL build the url for the route that registered with name , pairs is the list of param name and value
+// example : v.URL("user", "id", "101")
+func (v *vi) URL(name string, pairs ...string) (string, error) {
+	rt, ok := v.table.Load().named[name]
+	if !ok {
+		return "", fmt.Errorf("%w : %s", ErrRouteNotFound, name)
+	}
+
+	return rt.URL(pairs...)
+}
@@ -0,0 +1,200 @@
+package vi
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Named route and url building", func() {
+	var v *vi
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+
+	BeforeEach(func() {
+		v = New(&Config{Banner: false})
+		RegisterHelper("ip", `\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}`)
+		v.GET("/", handler).Name("home")
+		v.GET("/user/:name", handler).Name("user")
+		v.GET("/user/:name/post/:id?", handler).Name("post")
+		v.GET("/employee/{uid:[0-9]+}/{department:[a-zA-Z]+}", handler).Name("employee")
+		v.GET("/location/:ip", handler).Name("location")
+		v.GET("/*", handler).Name("all")
+		v.GET("/files/*path", handler).Name("files")
+		v.GET("/img/:name.:ext", handler).Name("image")
+		v.GET("/users/", handler).Name("users")
+		v.GET("/search/{q:.+}", handler).Name("search")
+	})
+
+	DescribeTable("Should build url from pattern", func(name string, pairs []string, expectUrl string, expectErr error) {
+		url, err := v.URL(name, pairs...)
+		if expectErr != nil {
+			Expect(err).To(MatchError(expectErr))
+			return
+		}
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(url).To(Equal(expectUrl))
+	},
+		Entry("root", "home", nil, "/", nil),
+		Entry("named param", "user", []string{"name", "anh"}, "/user/anh", nil),
+		Entry("optional param provided", "post", []string{"name", "anh", "id", "101"}, "/user/anh/post/101", nil),
+		Entry("optional param omitted", "post", []string{"name", "anh"}, "/user/anh/post", nil),
+		Entry("regex param", "employee", []string{"uid", "153", "department", "accounting"}, "/employee/153/accounting", nil),
+		Entry("helper param", "location", []string{"ip", "192.168.0.1"}, "/location/192.168.0.1", nil),
+		Entry("missing param", "user", nil, "", ErrMissingParam),
+		Entry("odd pairs", "user", []string{"name"}, "", ErrMissingParam),
+		Entry("regex mismatch", "employee", []string{"uid", "abc", "department", "accounting"}, "", ErrParamMismatch),
+		Entry("helper mismatch", "post", []string{"name", "anh", "id", "abc"}, "", ErrParamMismatch),
+		Entry("wildcard", "all", nil, "", ErrMissingParam),
+		Entry("named catch all", "files", []string{"path", "docs/a.txt"}, "/files/docs/a.txt", nil),
+		Entry("named catch all omitted", "files", nil, "/files", nil),
+		Entry("mixed segment", "image", []string{"name", "photo", "ext", "png"}, "/img/photo.png", nil),
+		Entry("mixed segment missing param", "image", []string{"name", "photo"}, "", ErrMissingParam),
+		Entry("unknown route", "unknown", nil, "", ErrRouteNotFound),
+		Entry("trailing slash", "users", nil, "/users/", nil),
+		Entry("escaped value", "search", []string{"q", "x?y=1"}, "/search/x%3Fy=1", nil),
+		Entry("escaped catch all keep slash", "files", []string{"path", "a b/c?d#e"}, "/files/a%20b/c%3Fd%23e", nil),
+	)
+
+	DescribeTable("Should route the built url back to the route", func(pattern string, pairs []string) {
+		v := New(&Config{Banner: false})
+		v.GET(pattern, func(w http.ResponseWriter, r *http.Request) {
+			for _, p := range Params(r) {
+				w.Write([]byte(p.Key + "=" + p.Value + ";"))
+			}
+		}).Name("route")
+
+		url, err := v.URL("route", pairs...)
+		Expect(err).ToNot(HaveOccurred())
+
+		var expect string
+		for i := 0; i < len(pairs); i += 2 {
+			expect += pairs[i] + "=" + pairs[i+1] + ";"
+		}
+		rec := httptest.NewRecorder()
+		v.ServeHTTP(rec, httptest.NewRequest("GET", url, http.NoBody))
+		Expect(rec.Code).To(Equal(http.StatusOK), "url %s", url)
+		Expect(rec.Body.String()).To(Equal(expect), "url %s", url)
+	},
+		Entry("trailing slash", "/users/", nil),
+		Entry("query and fragment in value", "/search/{q:.+}", []string{"q", "x?y=1#top"}),
+		Entry("space and percent in value", "/search/{q:.+}/raw", []string{"q", "50% off"}),
+		Entry("catch all", "/files/*path", []string{"path", "a b/c?d#e"}),
+		Entry("spanning param", "/docs/{path...}/edit", []string{"path", "guide/intro & setup"}),
+		Entry("mixed segment", "/img/{name:[^.]+}.:ext", []string{"name", "my photo", "ext", "png"}),
+	)
+
+	It("Should share the name among group", func() {
+		v.Group("/api").GET("/api/v1/:name", handler).Name("api")
+		url, err := v.URL("api", "name", "anh")
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(url).To(Equal("/api/v1/anh"))
+	})
+
+	It("Should expose route information", func() {
+		rt := v.POST("/user/:name", handler).Name("create")
+
+		Expect(rt.GetName()).To(Equal("create"))
+		Expect(rt.GetMethod()).To(Equal("POST"))
+		Expect(rt.GetPath()).To(Equal("/user/:name"))
+	})
+
+	It("Should panic on duplicate or empty name", func() {
+		Ω(func() { v.GET("/other", handler).Name("user") }).Should(Panic())
+		Ω(func() { v.GET("/other", handler).Name("") }).Should(Panic())
+	})
+})
+
+var _ = Describe("Route introspection", func() {
+	var v *vi
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	mw := func(next http.HandlerFunc) http.HandlerFunc { return next }
+
+	BeforeEach(func() {
+		v = New(&Config{Banner: false})
+		v.Use(mw)
+		v.GET("/user/:name", handler).Name("user").
+			Describe("Get user by name").
+			Tag("user").
+			Scope("user:read").
+			Meta("owner", "identity-team")
+		v.DELETE("/user/:name", handler).Tag("user", "admin").Scope("user:write")
+
+		admin := v.Group("/admin")
+		admin.Use(mw, mw)
+		admin.GET("/admin/stats", handler)
+		v.GET("/", handler)
+	})
+
+	It("Should list routes sorted by method then registration order", func() {
+		routes := v.Routes()
+		Expect(routes).To(HaveLen(4))
+
+		var listed []string
+		for _, info := range routes {
+			listed = append(listed, info.Method+" "+info.Path)
+		}
+		Expect(listed).To(Equal([]string{"DELETE /user/:name", "GET /user/:name", "GET /admin/stats", "GET /"}))
+
+		user := routes[1]
+		Expect(user.Name).To(Equal("user"))
+		Expect(user.Prefixes).To(Equal([]string{"/"}))
+		Expect(user.Middlewares).To(Equal(1))
+		Expect(user.Metadata).To(Equal(Metadata{
+			Description: "Get user by name",
+			Tags:        []string{"user"},
+			Scopes:      []string{"user:read"},
+			Values:      map[string]any{"owner": "identity-team"},
+		}))
+
+		stats := routes[2]
+		Expect(stats.Prefixes).To(Equal([]string{"/", "/admin"}))
+		Expect(stats.Middlewares).To(Equal(3))
+		Expect(stats.Metadata.Tags).To(BeEmpty())
+	})
+
+	It("Should not expose the route metadata for modification", func() {
+		v.Routes()[1].Metadata.Tags[0] = "modified"
+		v.Routes()[1].Metadata.Values["owner"] = "modified"
+
+		meta := v.Routes()[1].Route.GetMetadata()
+		Expect(meta.Tags).To(Equal([]string{"user"}))
+		Expect(meta.Values).To(HaveKeyWithValue("owner", "identity-team"))
+	})
+
+	It("Should walk until error", func() {
+		var walked []string
+		stop := errors.New("stop")
+		err := v.Walk(func(info RouteInfo) error {
+			walked = append(walked, info.Method)
+			if info.Method == "GET" {
+				return stop
+			}
+			return nil
+		})
+		Expect(err).To(MatchError(stop))
+		Expect(walked).To(Equal([]string{"DELETE", "GET"}))
+
+		walked = nil
+		Expect(v.Walk(func(info RouteInfo) error {
+			walked = append(walked, info.Path)
+			return ErrSkipAll
+		})).To(Succeed())
+		Expect(walked).To(HaveLen(1))
+	})
+
+	It("Should allow configuring route while walking", func() {
+		Expect(v.Walk(func(info RouteInfo) error {
+			info.Route.Tag("audited")
+			return nil
+		})).To(Succeed())
+
+		for _, info := range v.Routes() {
+			Expect(info.Metadata.Tags).To(ContainElement("audited"))
+		}
+	})
+})
@@ -0,0 +1,373 @@
+package vi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// maximum depth of nested schema , guard against recursive $ref
+const maxSchemaDepth = 64
+
+// validator validate decoded JSON value against JSON schema
+// $ref is resolve against the components schemas of the document
+// Supported keywords : $ref , type , enum , const , properties , required , additionalProperties , items ,
+// minItems , maxItems , minLength , maxLength , pattern , minimum , maximum , exclusiveMinimum , exclusiveMaximum ,
+// multipleOf , allOf , anyOf , oneOf
+type validator struct {
+	schemas map[string]Schema
+	// compiled pattern keyed by the pattern
+	patterns sync.Map
+}
+
+// violation is single failure of the value against the schema
+type violation struct {
+	// JSON pointer of the value
+	pointer string
+	detail  string
+}
+
+func newValidator(components *Components) *validator {
+	vd := new(validator)
+	if components != nil {
+		vd.schemas = components.Schemas
+	}
+	return vd
+}
+
+// validate value against schema , pointer is the JSON pointer of the value
+func (vd *validator) validate(schema Schema, value any, pointer string) []violation {
+	return vd.check(schema, value, pointer, 0)
+}
+
+func (vd *validator) check(schema Schema, value any, pointer string, depth int) []violation {
+	if schema == nil {
+		return nil
+	}
+	if depth > maxSchemaDepth {
+		return []violation{{pointer, "schema is nested too deep"}}
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		target, ok := vd.resolve(ref)
+		if !ok {
+			return []violation{{pointer, fmt.Sprintf("unresolved schema reference %s", ref)}}
+		}
+		return vd.check(target, value, pointer, depth+1)
+	}
+
+	if t, ok := schema["type"]; ok && !matchType(t, value) {
+		return []violation{{pointer, fmt.Sprintf("must be of type %v", t)}}
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if equalJSON(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return []violation{{pointer, fmt.Sprintf("must be one of %v", enum)}}
+		}
+	}
+	if c, ok := schema["const"]; ok && !equalJSON(c, value) {
+		return []violation{{pointer, fmt.Sprintf("must be %v", c)}}
+	}
+
+	var errs []violation
+	switch v := value.(type) {
+	case string:
+		errs = append(errs, vd.checkString(schema, v, pointer)...)
+	case []any:
+		errs = append(errs, vd.checkArray(schema, v, pointer, depth)...)
+	case map[string]any:
+		errs = append(errs, vd.checkObject(schema, v, pointer, depth)...)
+	default:
+		if n, ok := toFloat(v); ok {
+			errs = append(errs, checkNumber(schema, n, pointer)...)
+		}
+	}
+
+	errs = append(errs, vd.checkComposition(schema, value, pointer, depth)...)
+	return errs
+}
+
+// resolve local reference such as #/components/schemas/User
+func (vd *validator) resolve(ref string) (Schema, bool) {
+	name, ok := strings.CutPrefix(ref, "#/components/schemas/")
+	if !ok {
+		return nil, false
+	}
+	schema, ok := vd.schemas[name]
+	return schema, ok
+}
+
+func (vd *validator) checkString(schema Schema, s string, pointer string) []violation {
+	var errs []violation
+	length := utf8.RuneCountInString(s)
+	if min, ok := toFloat(schema["minLength"]); ok && float64(length) < min {
+		errs = append(errs, violation{pointer, fmt.Sprintf("length must be at least %v", min)})
+	}
+	if max, ok := toFloat(schema["maxLength"]); ok && float64(length) > max {
+		errs = append(errs, violation{pointer, fmt.Sprintf("length must be at most %v", max)})
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := vd.pattern(pattern)
+		if err != nil {
+			errs = append(errs, violation{pointer, fmt.Sprintf("invalid pattern %s : %v", pattern, err)})
+		} else if !re.MatchString(s) {
+			errs = append(errs, violation{pointer, fmt.Sprintf("must match pattern %s", pattern)})
+		}
+	}
+	return errs
+}
+
+// compile the pattern once
+func (vd *validator) pattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := vd.patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	vd.patterns.Store(pattern, re)
+	return re, nil
+}
+
+func checkNumber(schema Schema, n float64, pointer string) []violation {
+	var errs []violation
+	if min, ok := toFloat(schema["minimum"]); ok && n < min {
+		errs = append(errs, violation{pointer, fmt.Sprintf("must be at least %v", min)})
+	}
+	if max, ok := toFloat(schema["maximum"]); ok && n > max {
+		errs = append(errs, violation{pointer, fmt.Sprintf("must be at most %v", max)})
+	}
+	if min, ok := toFloat(schema["exclusiveMinimum"]); ok && n <= min {
+		errs = append(errs, violation{pointer, fmt.Sprintf("must be greater than %v", min)})
+	}
+	if max, ok := toFloat(schema["exclusiveMaximum"]); ok && n >= max {
+		errs = append(errs, violation{pointer, fmt.Sprintf("must be less than %v", max)})
+	}
+	if m, ok := toFloat(schema["multipleOf"]); ok && m > 0 {
+		if q := n / m; math.Abs(q-math.Round(q)) > 1e-9 {
+			errs = append(errs, violation{pointer, fmt.Sprintf("must be multiple of %v", m)})
+		}
+	}
+	return errs
+}
+
+func (vd *validator) checkArray(schema Schema, items []any, pointer string, depth int) []violation {
+	var errs []violation
+	if min, ok := toFloat(schema["minItems"]); ok && float64(len(items)) < min {
+		errs = append(errs, violation{pointer, fmt.Sprintf("must have at least %v items", min)})
+	}
+	if max, ok := toFloat(schema["maxItems"]); ok && float64(len(items)) > max {
+		errs = append(errs, violation{pointer, fmt.Sprintf("must have at most %v items", max)})
+	}
+	if itemSchema := asSchema(schema["items"]); itemSchema != nil {
+		for i, item := range items {
+			errs = append(errs, vd.check(itemSchema, item, pointer+"/"+strconv.Itoa(i), depth+1)...)
+		}
+	}
+	return errs
+}
+
+func (vd *validator) checkObject(schema Schema, object map[string]any, pointer string, depth int) []violation {
+	var errs []violation
+	if required, ok := schema["required"].([]any); ok {
+		for _, name := range required {
+			if key, ok := name.(string); ok {
+				if _, ok := object[key]; !ok {
+					errs = append(errs, violation{pointer + "/" + escapePointer(key), "is required"})
+				}
+			}
+		}
+	}
+
+	properties := asSchema(schema["properties"])
+	additional := schema["additionalProperties"]
+	for key, value := range object {
+		child := pointer + "/" + escapePointer(key)
+		if prop := asSchema(properties[key]); prop != nil {
+			errs = append(errs, vd.check(prop, value, child, depth+1)...)
+			continue
+		}
+		if _, ok := properties[key]; ok {
+			continue
+		}
+		if allowed, ok := additional.(bool); ok && !allowed {
+			errs = append(errs, violation{child, "is not allowed"})
+		} else if extra := asSchema(additional); extra != nil {
+			errs = append(errs, vd.check(extra, value, child, depth+1)...)
+		}
+	}
+	return errs
+}
+
+func (vd *validator) checkComposition(schema Schema, value any, pointer string, depth int) []violation {
+	var errs []violation
+	if all, ok := schema["allOf"].([]any); ok {
+		for _, s := range all {
+			errs = append(errs, vd.check(asSchema(s), value, pointer, depth+1)...)
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		matched := false
+		for _, s := range anyOf {
+			if len(vd.check(asSchema(s), value, pointer, depth+1)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			errs = append(errs, violation{pointer, "must match at least one schema in anyOf"})
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]any); ok {
+		matched := 0
+		for _, s := range oneOf {
+			if len(vd.check(asSchema(s), value, pointer, depth+1)) == 0 {
+				matched++
+			}
+		}
+		if matched != 1 {
+			errs = append(errs, violation{pointer, "must match exactly one schema in oneOf"})
+		}
+	}
+	return errs
+}
+
+// whether value is one of the JSON type , t is either single type or list of type
+func matchType(t any, value any) bool {
+	switch t := t.(type) {
+	case string:
+		return isType(t, value)
+	case []any:
+		for _, each := range t {
+			if s, ok := each.(string); ok && isType(s, value) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func isType(t string, value any) bool {
+	switch t {
+	case "null":
+		return value == nil
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "number":
+		_, ok := toFloat(value)
+		return ok
+	case "integer":
+		n, ok := toFloat(value)
+		return ok && n == math.Trunc(n)
+	}
+	return true
+}
+
+// convert numeric value decode from JSON or YAML into float64
+func toFloat(value any) (float64, bool) {
+	switch n := value.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// whether two decoded JSON value are equal , number are compare by value
+func equalJSON(a, b any) bool {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+
+	switch x := a.(type) {
+	case []any:
+		y, ok := b.([]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equalJSON(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any, Schema:
+		xm, ym := asObject(a), asObject(b)
+		if ym == nil || len(xm) != len(ym) {
+			return false
+		}
+		for k, xv := range xm {
+			yv, ok := ym[k]
+			if !ok || !equalJSON(xv, yv) {
+				return false
+			}
+		}
+		return true
+	case string, bool, nil:
+		return a == b
+	}
+	return false
+}
+
+// return the JSON object as map , nil if value is not an object
+func asObject(value any) map[string]any {
+	switch m := value.(type) {
+	case map[string]any:
+		return m
+	case Schema:
+		return m
+	}
+	return nil
+}
+
+// convert nested schema decode as plain map into Schema
+func asSchema(value any) Schema {
+	switch s := value.(type) {
+	case Schema:
+		return s
+	case map[string]any:
+		return s
+	}
+	return nil
+}
+
+// escape key to be use in JSON pointer
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,82 @@
+package vi
+
+// scope is node of the middleware scope tree , create by Group and With
+// middlewares of the scope are keep in the table , and apply to routes of the scope and its descendants
+type scope struct {
+	parent *scope
+	// prefix of the group , empty for scope create by With
+	prefix string
+}
+
+// whether s is ancestor or the same as other
+func (s *scope) contains(other *scope) bool {
+	for ; other != nil; other = other.parent {
+		if other == s {
+			return true
+		}
+	}
+	return false
+}
+
+// return the root scope , which belong to the instance create by New
+func (s *scope) root() *scope {
+	for s.parent != nil {
+		s = s.parent
+	}
+	return s
+}
+
+// return the scopes from the root to s
+func (s *scope) path() []*scope {
+	var scopes []*scope
+	for ; s != nil; s = s.parent {
+		scopes = append(scopes, s)
+	}
+	for i, j := 0, len(scopes)-1; i < j; i, j = i+1, j-1 {
+		scopes[i], scopes[j] = scopes[j], scopes[i]
+	}
+	return scopes
+}
+
+// return the prefixes of the groups from the root to s
+func (s *scope) prefixes() []string {
+	var prefixes []string
+	for _, sc := range s.path() {
+		if sc.prefix != "" {
+			prefixes = append(prefixes, sc.prefix)
+		}
+	}
+	return prefixes
+}
+
+// return the middlewares that run before the handler of the route , outermost first
+func (t *table) middlewaresOf(rt *Route) []middleware {
+	var all []middleware
+	for _, s := range rt.scope.path() {
+		all = append(all, t.middlewares[s]...)
+	}
+	return append(all, rt.middlewares...)
+}
+
+// chain the middlewares of the route with its handler once , so request does not chain them again
+func (t *table) build(rt *Route) {
+	all := t.middlewaresOf(rt)
+	handler := rt.loadHandler()
+	for i := len(all) - 1; i >= 0; i-- {
+		handler = all[i](handler)
+	}
+	rt.chain.Store(&handler)
+}
+
+// rebuild the chain of every route inside the scope
+func (t *table) rebuild(s *scope) {
+	for _, tree := range t.trees {
+		for _, leaf := range tree.leaves {
+			for _, rt := range leaf.routes {
+				if s.contains(rt.scope) {
+					t.build(rt)
+				}
+			}
+		}
+	}
+}
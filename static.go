@@ -0,0 +1,466 @@
+package vi
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	ospath "path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/diontr00/vi/internal/color"
+	"github.com/diontr00/vi/internal/utils"
+)
+
+// Static defines configuration options when defining static route
+type StaticConfig struct {
+	// Root is a filesystem  that provides access to a
+	// collection of files and directories , use http.Dir("folder name") or embed FS  with http.FS()
+	// Required
+	Root http.FileSystem
+	// Defines prefix that will be add to be when reading a file from FileSystem
+	// Use only when using go embed FS for Root
+	// Optional  default to ""
+	Prefix string
+	// Name of the index file that is serve for the directory , it is look up inside the requested directory
+	// Optional default to index.html
+	Index string
+	// The value for the cache-control HTTP-Header when response , its define in term of second , default value to 0
+	// Optional default to 0
+	MaxAge int
+	//  Next defines a function  that allow to skip a scenario when it return true
+	// Optional default to nil
+	Next func(w http.ResponseWriter, r *http.Request) bool
+	// File to return if path is not found. Useful for SPA's
+	// Optional default to 404 not found
+	NotFoundFile string
+	// Defines how the ETag of the file is compute , the ETag is use to answer If-None-Match and If-Range
+	// Optional default to ETagWeak
+	ETag ETagMode
+	// Serve the precompressed sibling file.br or file.gz when the client accept the encoding , br is prefer on equal quality
+	// Content-Type is the one of the original file , which must exist
+	// Optional default to false
+	Precompressed bool
+	// Compress the file with gzip on the fly when it has no precompressed sibling , range request is serve uncompressed
+	// Optional default to nil , which disable the compression
+	Compress *CompressConfig
+	// List the directory that has no index file , as JSON when the client accept application/json or ?format=json , HTML otherwise
+	// The listing can be sort with ?sort=name , size or time and ?order=asc or desc
+	// Optional default to false , which answer 403 Forbidden
+	Browse bool
+	// Include the file start with . in the listing , only when Dotfiles is DotfileAllow
+	// Optional default to false
+	BrowseDotfiles bool
+	// Decide how request for file or directory start with . , such as .env or .git/config , is handle
+	// Optional default to DotfileIgnore
+	Dotfiles DotfilePolicy
+	// Decide whether symlink that resolve outside the root is follow , only apply when Root is http.Dir
+	// Optional default to SymlinkDeny
+	Symlinks SymlinkPolicy
+	// Glob patterns of path that is never serve , answered with 404 as if the file does not exist
+	// Pattern without / match any segment , such as *.map or node_modules , pattern with / match the whole path , such as private/*.pem
+	// Optional default to nil
+	Deny []string
+}
+
+// DotfilePolicy decide how the file or directory start with . is handle
+type DotfilePolicy int
+
+const (
+	// answer 404 as if the file does not exist
+	DotfileIgnore DotfilePolicy = iota
+	// answer 403 Forbidden
+	DotfileDeny
+	// serve the file like any other file
+	DotfileAllow
+)
+
+// SymlinkPolicy decide how symlink that resolve outside the root is handle
+type SymlinkPolicy int
+
+const (
+	// answer 404 as if the file does not exist
+	SymlinkDeny SymlinkPolicy = iota
+	// serve the target of the symlink
+	SymlinkFollow
+)
+
+// ETagMode decide how the ETag of static file is compute
+type ETagMode int
+
+const (
+	// weak ETag from the modification time and size of the file
+	ETagWeak ETagMode = iota
+	// strong ETag from the content hash , the hash is cache until the modification time or size of the file change
+	ETagStrong
+	// no ETag , Last-Modified is still use to revalidate
+	ETagNone
+)
+
+// strong ETag of single file , valid as long as the modification time and size stay the same
+type etagEntry struct {
+	modtime time.Time
+	size    int64
+	etag    string
+}
+
+// compute the ETag of the file according to the mode , the file is rewind when its content is hash
+// strong ETag is cache in cache , keyed by the file path
+func fileETag(mode ETagMode, cache *sync.Map, name string, file http.File, stat fs.FileInfo) (string, error) {
+	switch mode {
+	case ETagNone:
+		return "", nil
+	case ETagWeak:
+		return fmt.Sprintf(`W/"%x-%x"`, stat.ModTime().UnixNano(), stat.Size()), nil
+	}
+
+	if v, ok := cache.Load(name); ok {
+		if e := v.(etagEntry); e.modtime.Equal(stat.ModTime()) && e.size == stat.Size() {
+			return e.etag, nil
+		}
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	etag := `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+	cache.Store(name, etagEntry{modtime: stat.ModTime(), size: stat.Size(), etag: etag})
+	return etag, nil
+}
+
+// Static will create a file server serving the static file
+// if path present the path pattern
+// Conditional request with If-None-Match or If-Modified-Since is answer with 304 , and Range request with 206 or 416
+func (v *vi) Static(path string, config *StaticConfig) {
+	var cfg = &StaticConfig{
+		Index:        "/index.html",
+		MaxAge:       0,
+		Next:         nil,
+		NotFoundFile: "",
+		Root:         nil,
+		Prefix:       "",
+	}
+
+	if config != nil {
+		cfg = config
+		if config.Index == "" {
+			cfg.Index = "index.html"
+		}
+		if !strings.HasPrefix(cfg.Index, "/") {
+			cfg.Index = "/" + cfg.Index
+		}
+		if cfg.NotFoundFile != "" && !strings.HasPrefix(cfg.NotFoundFile, "/") {
+			cfg.NotFoundFile = "/" + cfg.NotFoundFile
+		}
+	}
+
+	if cfg.Root == nil {
+		panic("Http file server root cannot be nil")
+	}
+
+	if cfg.Prefix != "" && !strings.HasPrefix(cfg.Prefix, "/") {
+		cfg.Prefix = "/" + cfg.Prefix
+	}
+
+	for _, pattern := range cfg.Deny {
+		if _, err := ospath.Match(pattern, ""); err != nil {
+			panic(color.Red("invalid deny pattern %s : %v", pattern, err))
+		}
+	}
+
+	if cfg.Compress != nil {
+		compress := *cfg.Compress
+		if compress.MinSize == 0 {
+			compress.MinSize = 1024
+		}
+		if compress.MIMETypes == nil {
+			compress.MIMETypes = compressMIMETypes
+		}
+		if compress.Level == 0 {
+			compress.Level = gzip.DefaultCompression
+		}
+		if _, err := gzip.NewWriterLevel(io.Discard, compress.Level); err != nil {
+			panic(color.Red("invalid compression level : %v", err))
+		}
+		cfg.Compress = &compress
+	}
+	v.registerStatic(path, cfg)
+}
+
+func (v *vi) registerStatic(path string, cfg *StaticConfig) {
+	res := newStaticResolver(cfg)
+	// strong ETag of the files
+	var etags sync.Map
+	// gzip writers for on the fly compression
+	var gzips sync.Pool
+	if cfg.Compress != nil {
+		gzips.New = func() any {
+			gz, _ := gzip.NewWriterLevel(io.Discard, cfg.Compress.Level)
+			return gz
+		}
+	}
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if cfg.Next != nil && cfg.Next(w, r) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		// path to search for static files
+		searchp, code := res.resolve(r.URL.Path)
+		switch code {
+		case 0:
+		case http.StatusNotFound:
+			staticNotFound(w, cfg)
+			return
+		default:
+			staticStatus(w, code)
+			return
+		}
+
+		file, err := cfg.Root.Open(searchp)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				staticNotFound(w, cfg)
+				return
+			} else {
+				staticError(w, searchp, err)
+				return
+			}
+		}
+
+		defer file.Close()
+		stat, err := file.Stat()
+		if err != nil {
+			staticError(w, searchp, err)
+			return
+		}
+
+		// Serve the index inside the directory
+		if stat.IsDir() {
+			// directory is address with the trailing slash , so relative link inside the index resolve against it
+			if !strings.HasSuffix(r.URL.Path, "/") {
+				path, raw := v.routingPath(r)
+				v.fixPath(w, r, path+"/", raw, PathRedirect)
+				return
+			}
+
+			dir := file
+			index, err := cfg.Root.Open(ospath.Join(searchp, cfg.Index))
+			if err == nil && res.escapes(ospath.Join(searchp, cfg.Index)) {
+				index.Close()
+				err = fs.ErrNotExist
+			}
+			if err == nil {
+				defer index.Close()
+				stat, err = index.Stat()
+			}
+			switch {
+			case err == nil && !stat.IsDir():
+				file = index
+				searchp = ospath.Join(searchp, cfg.Index)
+			case err != nil && !errors.Is(err, fs.ErrNotExist):
+				staticError(w, searchp, err)
+				return
+			case cfg.Browse:
+				browse(w, r, dir, searchp, res)
+				return
+			default:
+				staticStatus(w, http.StatusForbidden)
+				return
+			}
+		}
+
+		mimeType := utils.GetFileExtension(searchp)
+		w.Header().Set("Content-Type", utils.GetMIME(mimeType))
+		staticCache(w, cfg)
+
+		if cfg.Precompressed || cfg.Compress != nil {
+			w.Header().Add("Vary", "Accept-Encoding")
+		}
+
+		// name of the file that is serve
+		name := searchp
+		acceptEncoding := r.Header.Get("Accept-Encoding")
+		if cfg.Precompressed {
+			if sibling, siblingStat, siblingName, coding := openPrecompressed(cfg.Root, searchp, acceptEncoding); sibling != nil {
+				defer sibling.Close()
+				file, stat, name = sibling, siblingStat, siblingName
+				w.Header().Set("Content-Encoding", coding)
+			}
+		}
+
+		etag, err := fileETag(cfg.ETag, &etags, name, file, stat)
+		if err != nil {
+			staticError(w, name, err)
+			return
+		}
+
+		// range of the compressed body is not known in advance , so range request is serve uncompressed
+		if cfg.Compress != nil && name == searchp && r.Header.Get("Range") == "" && stat.Size() >= cfg.Compress.MinSize &&
+			matchMIME(cfg.Compress.MIMETypes, w.Header().Get("Content-Type")) && acceptQuality(acceptEncoding, "gzip") > 0 {
+			etag = gzipETag(etag)
+			gw := &gzipResponseWriter{ResponseWriter: w, pool: &gzips}
+			defer gw.close()
+			w = gw
+		}
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+
+		// handle the conditional and range request , and set Content-Length , Last-Modified and Accept-Ranges
+		http.ServeContent(w, r, searchp, stat.ModTime(), file)
+	}
+	// serve every file under static path
+	if isStaticRank(rankPath(path)) {
+		path = strings.TrimSuffix(path, "/") + "/*"
+	}
+	v.Add(http.MethodGet, path, handler)
+}
+
+// answer 500 when the file couldn't be read
+func staticError(w http.ResponseWriter, name string, err error) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write([]byte("500 server internal error"))
+	log.Print(color.Red("[Error] , could not open file %s for reading : %v \n", color.Bold(name), err))
+}
+
+// answer 404 with the not found file , or with plain text when it is not set
+func staticNotFound(w http.ResponseWriter, cfg *StaticConfig) {
+	if cfg.NotFoundFile != "" {
+		nffile, err := cfg.Root.Open(cfg.NotFoundFile)
+		if err == nil {
+			defer nffile.Close()
+			w.Header().Set("Content-Type", utils.GetMIME(utils.GetFileExtension(cfg.NotFoundFile)))
+			staticCache(w, cfg)
+			w.WriteHeader(http.StatusNotFound)
+			bufio.NewReader(nffile).WriteTo(w)
+			return
+		}
+		log.Print(color.Red("[Warning] , not found file couldn't be open : %v \n", err))
+	}
+	staticStatus(w, http.StatusNotFound)
+}
+
+// set the Cache-Control of the served file when MaxAge is set
+func staticCache(w http.ResponseWriter, cfg *StaticConfig) {
+	if cfg.MaxAge > 0 {
+		w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(cfg.MaxAge))
+	}
+}
+
+// answer the status with plain text body , such as 404 Not Found
+func staticStatus(w http.ResponseWriter, code int) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(code)
+	w.Write([]byte(strconv.Itoa(code) + " " + http.StatusText(code)))
+}
+
+// staticResolver map the url path to the file name inside the root , according to the policies of the config
+type staticResolver struct {
+	cfg *StaticConfig
+	// real path of the root when it is http.Dir , use to detect symlink that escape the root
+	dir string
+}
+
+func newStaticResolver(cfg *StaticConfig) *staticResolver {
+	res := &staticResolver{cfg: cfg}
+	if dir, ok := cfg.Root.(http.Dir); ok && cfg.Symlinks == SymlinkDeny {
+		root := string(dir)
+		if root == "" {
+			root = "."
+		}
+		if real, err := filepath.EvalSymlinks(root); err == nil {
+			res.dir, _ = filepath.Abs(real)
+		}
+	}
+	return res
+}
+
+// resolve the name of the file to open for the url path , code is not zero when the request is refuse
+// the name is always clean and rooted , so it can not refer to file outside the root
+func (res *staticResolver) resolve(urlPath string) (name string, code int) {
+	// null byte , backslash and invalid UTF-8 are never part of valid path , backslash is the separator on windows
+	if strings.ContainsAny(urlPath, "\x00\\") || !utf8.ValidString(urlPath) {
+		return "", http.StatusBadRequest
+	}
+
+	clean := ospath.Clean("/" + urlPath)
+	if res.cfg.Dotfiles != DotfileAllow && hasDotSegment(clean) {
+		if res.cfg.Dotfiles == DotfileDeny {
+			return "", http.StatusForbidden
+		}
+		return "", http.StatusNotFound
+	}
+	if res.denied(clean) {
+		return "", http.StatusNotFound
+	}
+
+	name = clean
+	if res.cfg.Prefix != "" {
+		name = res.cfg.Prefix + clean
+	}
+	if len(name) > 1 {
+		name = strings.TrimSuffix(name, "/")
+	}
+	if res.escapes(name) {
+		return "", http.StatusNotFound
+	}
+	return name, 0
+}
+
+// whether any segment of the clean path start with .
+func hasDotSegment(p string) bool {
+	return strings.Contains(p, "/.")
+}
+
+// whether the clean path match one of the deny patterns
+func (res *staticResolver) denied(p string) bool {
+	rel := strings.TrimPrefix(p, "/")
+	for _, pattern := range res.cfg.Deny {
+		if strings.Contains(pattern, "/") {
+			if ok, _ := ospath.Match(strings.TrimPrefix(pattern, "/"), rel); ok {
+				return true
+			}
+			continue
+		}
+		for _, seg := range strings.Split(rel, "/") {
+			if ok, _ := ospath.Match(pattern, seg); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// whether the file resolve outside the root through symlink , always false unless the symlinks are deny for http.Dir
+func (res *staticResolver) escapes(name string) bool {
+	if res.dir == "" {
+		return false
+	}
+
+	target, err := filepath.EvalSymlinks(filepath.Join(res.dir, filepath.FromSlash(name)))
+	if err != nil {
+		// the file does not exist , opening it report the error
+		return false
+	}
+	rel, err := filepath.Rel(res.dir, target)
+	return err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
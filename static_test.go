@@ -0,0 +1,432 @@
+package vi
+
+import (
+	"compress/gzip"
+	"embed"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Static conditional and range request", func() {
+	const root = "./.github/testdata/fs"
+	content, _ := os.ReadFile(root + "/index.html")
+
+	serve := func(v *vi, method, url string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, http.NoBody)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		rec := httptest.NewRecorder()
+		v.ServeHTTP(rec, req)
+		return rec
+	}
+	newVi := func(mode ETagMode) *vi {
+		v := New(nil)
+		v.Static("/", &StaticConfig{Root: http.Dir(root), ETag: mode})
+		return v
+	}
+
+	It("Should set the validators and the length", func() {
+		rec := serve(newVi(ETagWeak), "GET", "/index.html")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("ETag")).To(HavePrefix(`W/"`))
+		Expect(rec.Header().Get("Last-Modified")).ToNot(BeEmpty())
+		Expect(rec.Header().Get("Accept-Ranges")).To(Equal("bytes"))
+		Expect(rec.Header().Get("Content-Length")).To(Equal(strconv.Itoa(len(content))))
+		Expect(rec.Body.Bytes()).To(Equal(content))
+
+		strong := serve(newVi(ETagStrong), "GET", "/index.html").Header().Get("ETag")
+		Expect(strong).To(MatchRegexp(`^"[0-9a-f]{32}"$`))
+		Expect(serve(newVi(ETagStrong), "GET", "/index.html").Header().Get("ETag")).To(Equal(strong), "content hash is stable")
+		Expect(serve(newVi(ETagNone), "GET", "/index.html").Header().Get("ETag")).To(BeEmpty())
+	})
+
+	DescribeTable("Should revalidate", func(mode ETagMode) {
+		v := newVi(mode)
+		first := serve(v, "GET", "/index.html")
+
+		rec := serve(v, "GET", "/index.html", "If-Modified-Since", first.Header().Get("Last-Modified"))
+		Expect(rec.Code).To(Equal(http.StatusNotModified))
+		Expect(rec.Body.Len()).To(BeZero())
+
+		if etag := first.Header().Get("ETag"); etag != "" {
+			Expect(serve(v, "GET", "/index.html", "If-None-Match", etag).Code).To(Equal(http.StatusNotModified))
+			Expect(serve(v, "HEAD", "/index.html", "If-None-Match", etag).Code).To(Equal(http.StatusNotModified))
+			Expect(serve(v, "GET", "/index.html", "If-None-Match", `"other"`).Code).To(Equal(http.StatusOK))
+		}
+	},
+		Entry("weak", ETagWeak),
+		Entry("strong", ETagStrong),
+		Entry("none", ETagNone),
+	)
+
+	It("Should serve single and multipart range", func() {
+		v := newVi(ETagStrong)
+
+		rec := serve(v, "GET", "/index.html", "Range", "bytes=0-9")
+		Expect(rec.Code).To(Equal(http.StatusPartialContent))
+		Expect(rec.Header().Get("Content-Range")).To(Equal("bytes 0-9/" + strconv.Itoa(len(content))))
+		Expect(rec.Body.Bytes()).To(Equal(content[:10]))
+
+		rec = serve(v, "GET", "/index.html", "Range", "bytes=-5")
+		Expect(rec.Body.Bytes()).To(Equal(content[len(content)-5:]))
+
+		rec = serve(v, "GET", "/index.html", "Range", "bytes=0-1,5-6")
+		Expect(rec.Code).To(Equal(http.StatusPartialContent))
+		Expect(rec.Header().Get("Content-Type")).To(HavePrefix("multipart/byteranges"))
+		Expect(rec.Body.String()).To(ContainSubstring("Content-Type: text/html"))
+		Expect(rec.Body.String()).To(ContainSubstring(string(content[5:7])))
+
+		rec = serve(v, "GET", "/index.html", "Range", "bytes=100000-")
+		Expect(rec.Code).To(Equal(http.StatusRequestedRangeNotSatisfiable))
+		Expect(rec.Header().Get("Content-Range")).To(Equal("bytes */" + strconv.Itoa(len(content))))
+	})
+
+	It("Should resume only when If-Range match the strong ETag", func() {
+		strong := newVi(ETagStrong)
+		etag := serve(strong, "GET", "/index.html").Header().Get("ETag")
+		Expect(serve(strong, "GET", "/index.html", "Range", "bytes=0-9", "If-Range", etag).Code).To(Equal(http.StatusPartialContent))
+		Expect(serve(strong, "GET", "/index.html", "Range", "bytes=0-9", "If-Range", `"stale"`).Code).To(Equal(http.StatusOK))
+
+		weak := newVi(ETagWeak)
+		etag = serve(weak, "GET", "/index.html").Header().Get("ETag")
+		Expect(strings.HasPrefix(etag, "W/")).To(BeTrue())
+		Expect(serve(weak, "GET", "/index.html", "Range", "bytes=0-9", "If-Range", etag).Code).To(Equal(http.StatusOK), "weak ETag can not be use for range")
+	})
+})
+
+var _ = Describe("Static compression", func() {
+	const root = "./.github/testdata/fs"
+	css, _ := os.ReadFile(root + "/css/style.css")
+	cssBr, _ := os.ReadFile(root + "/css/style.css.br")
+	cssGz, _ := os.ReadFile(root + "/css/style.css.gz")
+	html, _ := os.ReadFile(root + "/index.html")
+
+	serve := func(v *vi, url, acceptEncoding string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", url, http.NoBody)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		rec := httptest.NewRecorder()
+		v.ServeHTTP(rec, req)
+		return rec
+	}
+
+	DescribeTable("Should negotiate the precompressed sibling", func(acceptEncoding, expectEncoding string, expectBody []byte) {
+		v := New(nil)
+		v.Static("/", &StaticConfig{Root: http.Dir(root), Precompressed: true})
+
+		rec := serve(v, "/css/style.css", acceptEncoding)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Content-Encoding")).To(Equal(expectEncoding))
+		Expect(rec.Header().Get("Content-Type")).To(Equal("text/css"))
+		Expect(rec.Header().Get("Vary")).To(Equal("Accept-Encoding"))
+		Expect(rec.Body.Bytes()).To(Equal(expectBody))
+	},
+		Entry("prefer br", "gzip, br", "br", cssBr),
+		Entry("quality", "br;q=0.5, gzip", "gzip", cssGz),
+		Entry("only gzip", "gzip", "gzip", cssGz),
+		Entry("refused", "br;q=0, gzip;q=0", "", css),
+		Entry("wildcard", "*", "br", cssBr),
+		Entry("no header", "", "", css),
+	)
+
+	It("Should give each representation its own ETag", func() {
+		v := New(nil)
+		v.Static("/", &StaticConfig{Root: http.Dir(root), Precompressed: true, ETag: ETagStrong})
+
+		br := serve(v, "/css/style.css", "br").Header().Get("ETag")
+		identity := serve(v, "/css/style.css", "").Header().Get("ETag")
+		Expect(br).ToNot(Equal(identity))
+		Expect(serve(v, "/css/style.css", "br", "If-None-Match", br).Code).To(Equal(http.StatusNotModified))
+		Expect(serve(v, "/css/style.css", "", "If-None-Match", br).Code).To(Equal(http.StatusOK))
+	})
+
+	It("Should compress on the fly above the threshold and for allowed MIME", func() {
+		v := New(nil)
+		v.Static("/", &StaticConfig{Root: http.Dir(root), Compress: &CompressConfig{MinSize: 100}})
+
+		rec := serve(v, "/index.html", "gzip")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Content-Encoding")).To(Equal("gzip"))
+		Expect(rec.Header().Get("Content-Length")).To(BeEmpty())
+		Expect(rec.Header().Get("ETag")).To(HaveSuffix(`-gzip"`))
+		gz, err := gzip.NewReader(rec.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(io.ReadAll(gz)).To(Equal(html))
+
+		etag := rec.Header().Get("ETag")
+		Expect(serve(v, "/index.html", "gzip", "If-None-Match", etag).Code).To(Equal(http.StatusNotModified))
+
+		rec = serve(v, "/index.html", "gzip", "Range", "bytes=0-9")
+		Expect(rec.Code).To(Equal(http.StatusPartialContent))
+		Expect(rec.Header().Get("Content-Encoding")).To(BeEmpty())
+		Expect(rec.Header().Get("Content-Range")).To(Equal("bytes 0-9/" + strconv.Itoa(len(html))))
+		Expect(rec.Body.Bytes()).To(Equal(html[:10]))
+
+		Expect(serve(v, "/css/style.css", "gzip").Header().Get("Content-Encoding")).To(BeEmpty(), "below the threshold")
+		Expect(serve(v, "/index.html", "br").Header().Get("Content-Encoding")).To(BeEmpty())
+
+		v = New(nil)
+		v.Static("/", &StaticConfig{Root: http.Dir(root), Compress: &CompressConfig{MinSize: 1, MIMETypes: []string{"text/css"}}, Precompressed: true})
+		Expect(serve(v, "/index.html", "gzip").Header().Get("Content-Encoding")).To(BeEmpty(), "MIME is not allowed")
+		Expect(serve(v, "/css/style.css", "gzip").Body.Bytes()).To(Equal(cssGz), "precompressed sibling take precedence")
+
+		Ω(func() {
+			New(nil).Static("/", &StaticConfig{Root: http.Dir(root), Compress: &CompressConfig{Level: 42}})
+		}).Should(Panic())
+	})
+})
+
+var _ = Describe("Static directory", func() {
+	var (
+		v    *vi
+		root string
+	)
+	serve := func(url string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", url, http.NoBody)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		rec := httptest.NewRecorder()
+		v.ServeHTTP(rec, req)
+		return rec
+	}
+	names := func(rec *httptest.ResponseRecorder) []string {
+		var entries []listEntry
+		Expect(json.Unmarshal(rec.Body.Bytes(), &entries)).To(Succeed())
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name)
+		}
+		return names
+	}
+
+	BeforeEach(func() {
+		root = GinkgoT().TempDir()
+		now := time.Now()
+		for i, f := range []struct {
+			name string
+			size int
+		}{{"b.txt", 10}, {"a.txt", 100}, {"c <x>.txt", 50}, {".env", 1}} {
+			p := filepath.Join(root, f.name)
+			Expect(os.WriteFile(p, []byte(strings.Repeat("x", f.size)), 0o644)).To(Succeed())
+			Expect(os.Chtimes(p, now, now.Add(time.Duration(i)*time.Hour))).To(Succeed())
+		}
+		Expect(os.MkdirAll(filepath.Join(root, "z", "docs"), 0o755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(root, "z", "docs", "index.html"), []byte("docs"), 0o644)).To(Succeed())
+
+		v = New(nil)
+		v.Static("/", &StaticConfig{Root: http.Dir(root), Browse: true})
+	})
+
+	It("Should serve the index of the requested directory and list the other", func() {
+		Expect(serve("/z/docs/").Body.String()).To(Equal("docs"))
+		Expect(serve("/z/docs").Header().Get("Location")).To(Equal("/z/docs/"))
+
+		rec := serve("/")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Content-Type")).To(Equal("text/html; charset=utf-8"))
+		body := rec.Body.String()
+		Expect(body).To(ContainSubstring(`<a href="z/">z/</a>`))
+		Expect(body).To(ContainSubstring(`<a href="c%20%3Cx%3E.txt">c &lt;x&gt;.txt</a>`))
+		Expect(body).To(ContainSubstring(`<td>100</td>`))
+		Expect(body).To(ContainSubstring(`?sort=name&amp;order=desc`))
+		Expect(body).ToNot(ContainSubstring(".env"))
+		Expect(body).ToNot(ContainSubstring(`href="../"`))
+		Expect(serve("/z/").Body.String()).To(ContainSubstring(`href="../"`))
+	})
+
+	It("Should list as JSON and sort", func() {
+		Expect(names(serve("/", "Accept", "application/json"))).To(Equal([]string{"z", "a.txt", "b.txt", "c <x>.txt"}))
+		Expect(names(serve("/?format=json&sort=size"))).To(Equal([]string{"z", "b.txt", "c <x>.txt", "a.txt"}))
+		Expect(names(serve("/?format=json&sort=time&order=desc"))).To(Equal([]string{"z", "c <x>.txt", "a.txt", "b.txt"}))
+
+		var entries []listEntry
+		Expect(json.Unmarshal(serve("/?format=json&sort=size").Body.Bytes(), &entries)).To(Succeed())
+		Expect(entries[1].Size).To(Equal(int64(10)))
+		Expect(entries[1].ModTime).ToNot(BeZero())
+		Expect(entries[0].IsDir).To(BeTrue())
+
+		v = New(nil)
+		v.Static("/", &StaticConfig{Root: http.Dir(root), Browse: true, BrowseDotfiles: true, Dotfiles: DotfileAllow})
+		Expect(names(serve("/?format=json"))).To(ContainElement(".env"))
+	})
+
+	It("Should forbid directory without index when browse is off and redirect relative to the mount point", func() {
+		v = New(nil)
+		v.Static("/", &StaticConfig{Root: http.Dir(root)})
+		Expect(serve("/").Code).To(Equal(http.StatusForbidden))
+		Expect(serve("/missing").Code).To(Equal(http.StatusNotFound))
+
+		inner := v
+		v = New(nil)
+		v.Mount("/assets", inner)
+		Expect(serve("/assets/z/docs").Header().Get("Location")).To(Equal("/assets/z/docs/"))
+	})
+})
+
+// layout the static root with dotfile , nested file and symlink that escape the root
+// the file outside the root contain the secret marker
+func staticFixture(base string) (root string) {
+	root = filepath.Join(base, "root")
+	outside := filepath.Join(base, "outside")
+	for _, dir := range []string{filepath.Join(root, ".git"), filepath.Join(root, "private"), filepath.Join(root, "node_modules"), outside} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			panic(err)
+		}
+	}
+	files := map[string]string{
+		filepath.Join(root, "index.html"):            "index",
+		filepath.Join(root, "app.js"):                "app",
+		filepath.Join(root, "app.js.map"):            "map",
+		filepath.Join(root, ".env"):                  "SECRET dotfile",
+		filepath.Join(root, ".git", "config"):        "SECRET git",
+		filepath.Join(root, "private", "key.pem"):    "SECRET pem",
+		filepath.Join(root, "node_modules", "x.js"):  "module",
+		filepath.Join(outside, "secret.txt"):         "SECRET outside",
+		filepath.Join(outside, "inside-target.html"): "SECRET target",
+	}
+	for p, content := range files {
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			panic(err)
+		}
+	}
+	os.Symlink(outside, filepath.Join(root, "escape"))
+	os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "secret.txt"))
+	os.Symlink("app.js", filepath.Join(root, "alias.js"))
+	return root
+}
+
+var _ = Describe("Static path policies", func() {
+	var root string
+	serve := func(cfg StaticConfig, url string) *httptest.ResponseRecorder {
+		if cfg.Root == nil {
+			cfg.Root = http.Dir(root)
+		}
+		v := New(nil)
+		v.Static("/", &cfg)
+		req := httptest.NewRequest("GET", "/", http.NoBody)
+		req.URL.Path = url
+		rec := httptest.NewRecorder()
+		v.ServeHTTP(rec, req)
+		return rec
+	}
+
+	BeforeEach(func() {
+		root = staticFixture(GinkgoT().TempDir())
+	})
+
+	DescribeTable("Should apply the policy", func(cfg StaticConfig, url string, expectStatus int, expectBody string) {
+		rec := serve(cfg, url)
+		Expect(rec.Code).To(Equal(expectStatus))
+		if expectBody != "" {
+			Expect(rec.Body.String()).To(Equal(expectBody))
+		}
+	},
+		Entry("serve file", StaticConfig{}, "/app.js", http.StatusOK, "app"),
+		Entry("ignore dotfile", StaticConfig{}, "/.env", http.StatusNotFound, ""),
+		Entry("ignore dot directory", StaticConfig{}, "/.git/config", http.StatusNotFound, ""),
+		Entry("deny dotfile", StaticConfig{Dotfiles: DotfileDeny}, "/.git/config", http.StatusForbidden, ""),
+		Entry("allow dotfile", StaticConfig{Dotfiles: DotfileAllow}, "/.env", http.StatusOK, "SECRET dotfile"),
+		Entry("deny segment pattern", StaticConfig{Deny: []string{"*.map"}}, "/app.js.map", http.StatusNotFound, ""),
+		Entry("deny directory", StaticConfig{Deny: []string{"node_modules"}}, "/node_modules/x.js", http.StatusNotFound, ""),
+		Entry("deny path pattern", StaticConfig{Deny: []string{"private/*.pem"}}, "/private/key.pem", http.StatusNotFound, ""),
+		Entry("path pattern is anchored", StaticConfig{Deny: []string{"private/*.pem"}}, "/app.js", http.StatusOK, "app"),
+		Entry("deny symlink outside root", StaticConfig{}, "/secret.txt", http.StatusNotFound, ""),
+		Entry("deny directory symlink outside root", StaticConfig{}, "/escape/secret.txt", http.StatusNotFound, ""),
+		Entry("symlink inside root", StaticConfig{}, "/alias.js", http.StatusOK, "app"),
+		Entry("follow symlink", StaticConfig{Symlinks: SymlinkFollow}, "/escape/secret.txt", http.StatusOK, "SECRET outside"),
+		Entry("null byte", StaticConfig{}, "/app.js\x00.html", http.StatusBadRequest, ""),
+		Entry("backslash", StaticConfig{}, `/..\..\outside\secret.txt`, http.StatusBadRequest, ""),
+		Entry("traversal", StaticConfig{}, "/../outside/secret.txt", http.StatusNotFound, ""),
+	)
+
+	It("Should not list what can not be serve", func() {
+		rec := serve(StaticConfig{Browse: true, BrowseDotfiles: true, Deny: []string{"*.map"}}, "/private/")
+		Expect(rec.Body.String()).To(ContainSubstring("key.pem"))
+
+		rec = serve(StaticConfig{Browse: true, BrowseDotfiles: true, Deny: []string{"*.map"}, Index: "none.html"}, "/")
+		Expect(rec.Body.String()).ToNot(ContainSubstring(".env"), "dotfile is not allowed")
+		Expect(rec.Body.String()).ToNot(ContainSubstring("app.js.map"))
+		Expect(rec.Body.String()).To(ContainSubstring("app.js"))
+		Expect(rec.Body.String()).To(ContainSubstring("alias.js"), "symlink inside the root is listed")
+		Expect(rec.Body.String()).ToNot(ContainSubstring("secret.txt"), "symlink outside the root is not listed")
+		Expect(rec.Body.String()).ToNot(ContainSubstring(`"escape/"`))
+
+		rec = serve(StaticConfig{Browse: true, Index: "none.html", Symlinks: SymlinkFollow}, "/")
+		Expect(rec.Body.String()).To(ContainSubstring("secret.txt"), "symlink is listed when followed")
+
+		Ω(func() { New(nil).Static("/", &StaticConfig{Root: http.Dir(root), Deny: []string{"["}}) }).Should(Panic())
+	})
+})
+
+// root contain dotfiles and secret , and outside is the sibling of the root that must never be serve
+//
+//go:embed all:.github/testdata/fuzz
+var staticEmbedFS embed.FS
+
+// FuzzStaticResolve check that no url path can be resolve outside the root , for both http.Dir and embed FS
+func FuzzStaticResolve(f *testing.F) {
+	for _, seed := range []string{
+		"/", "/app.js", "/../outside/secret.txt", "/escape/secret.txt", "/secret.txt", "/.env", "/.git/config",
+		"/./.env", "//..//..//outside", "/%2e%2e/outside", "..", "", "/app.js\x00", `\..\outside`, "/private/key.pem",
+		"/index.html/", "/a/../../../outside/secret.txt", "/escape/", "/escape/inside-target.html", "\xfe0",
+		"/.hidden/config", "/sub/../../outside/secret.txt", "/private/", "/.hidden/",
+	} {
+		f.Add(seed)
+	}
+
+	root := staticFixture(f.TempDir())
+	sub, err := fs.Sub(staticEmbedFS, ".github/testdata/fuzz/root")
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	dir := New(nil)
+	dir.Static("/", &StaticConfig{Root: http.Dir(root), Browse: true, Deny: []string{"private/*.pem"}})
+	embedded := New(nil)
+	embedded.Static("/", &StaticConfig{Root: http.FS(sub), Browse: true, Deny: []string{"private/*.pem"}})
+	resolvers := []*staticResolver{
+		newStaticResolver(&StaticConfig{Root: http.Dir(root)}),
+		newStaticResolver(&StaticConfig{Root: http.FS(sub), Prefix: "/sub"}),
+	}
+
+	f.Fuzz(func(t *testing.T, p string) {
+		for _, res := range resolvers {
+			name, code := res.resolve(p)
+			if code != 0 {
+				continue
+			}
+			if !strings.HasPrefix(name, "/") || !fs.ValidPath(strings.TrimPrefix(name, "/")) && name != "/" {
+				t.Fatalf("resolve %q to invalid name %q", p, name)
+			}
+			if hasDotSegment(name) {
+				t.Fatalf("resolve %q to ignored dotfile %q", p, name)
+			}
+		}
+
+		for _, v := range []*vi{dir, embedded} {
+			req := httptest.NewRequest("GET", "/", http.NoBody)
+			req.URL.Path = p
+			rec := httptest.NewRecorder()
+			v.ServeHTTP(rec, req)
+			if strings.Contains(rec.Body.String(), "SECRET") {
+				t.Fatalf("serve secret for %q : %d %s", p, rec.Code, rec.Body.String())
+			}
+		}
+	})
+}
@@ -0,0 +1,154 @@
+package vi
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// table is the snapshot of the routing state , it is never modify once published
+// writer modify a clone of the current table and publish it , so request can read the table without lock
+type table struct {
+	// routing tree per method
+	trees map[string]*tree
+	// middlewares registered on each scope
+	middlewares map[*scope][]middleware
+	// map between route name and route , use to build url
+	named map[string]*Route
+}
+
+// router hold the state shared between vi instance and its groups
+type router struct {
+	// serialize the writers
+	mu sync.Mutex
+	// current routing table
+	table atomic.Pointer[table]
+	// not found error handler
+	notfoundhandler http.HandlerFunc
+	// method not allowed error handler
+	methodnotallowedhandler http.HandlerFunc
+	// serve HEAD request with GET handler
+	autohead bool
+	// answer OPTIONS request with the Allow header
+	autooptions bool
+	// policy for path that differ by the trailing slash
+	trailingslash PathPolicy
+	// policy for path that is not clean
+	cleanpath PathPolicy
+	// match against the raw path
+	rawpath bool
+	// maximum size of the body validated against the OpenAPI document , negative for no limit
+	maxbodysize int64
+}
+
+func newTable() *table {
+	return &table{
+		trees:       make(map[string]*tree),
+		middlewares: make(map[*scope][]middleware),
+		named:       make(map[string]*Route),
+	}
+}
+
+// clone the maps of the table , trees is share and should be clone before modify
+func (t *table) clone() *table {
+	next := &table{
+		trees:       make(map[string]*tree, len(t.trees)),
+		middlewares: make(map[*scope][]middleware, len(t.middlewares)),
+		named:       make(map[string]*Route, len(t.named)),
+	}
+	for k, v := range t.trees {
+		next.trees[k] = v
+	}
+	for k, v := range t.middlewares {
+		next.middlewares[k] = v
+	}
+	for k, v := range t.named {
+		next.named[k] = v
+	}
+	return next
+}
+
+// run fn against the clone of the current table and publish the clone
+// the current table stay untouched if fn panic
+func (rt *router) update(fn func(t *table)) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	next := rt.table.Load().clone()
+	fn(next)
+	rt.table.Store(next)
+}
+
+// adopt every route in the table to rt , so route configured after swap update rt table
+// routes , groups and middlewares of the root scope from are moved under the root scope to ,
+// so middlewares registered on rt afterward apply to them
+func (t *table) adopt(rt *router, from, to *scope) {
+	reparent := func(s *scope) {
+		for ; s != nil; s = s.parent {
+			if s.parent == from {
+				s.parent = to
+			}
+		}
+	}
+
+	if from != to {
+		if mws, ok := t.middlewares[from]; ok {
+			t.middlewares[to] = mws
+			delete(t.middlewares, from)
+		}
+		for s := range t.middlewares {
+			reparent(s)
+		}
+	}
+
+	for _, tree := range t.trees {
+		for _, leaf := range tree.leaves {
+			for _, route := range leaf.routes {
+				if route.router != rt {
+					route.router = rt
+				}
+				if from != to {
+					if route.scope == from {
+						route.scope = to
+					}
+					reparent(route.scope)
+				}
+			}
+		}
+	}
+}
+
+// deep clone the tree , routes are share between the clone
+func (tree *tree) clone() *tree {
+	clones := make(map[*treenode]*treenode, tree.size)
+	next := newTree()
+	next.root = tree.root.clone(clones)
+	next.size = tree.size
+	next.fold = tree.fold
+	next.leaves = make([]*treenode, len(tree.leaves))
+	for i, leaf := range tree.leaves {
+		next.leaves[i] = clones[leaf]
+	}
+	return next
+}
+
+// deep clone the node and its children , record each clone in clones
+func (node *treenode) clone(clones map[*treenode]*treenode) *treenode {
+	next := *node
+	next.routes = append([]*Route(nil), node.routes...)
+	next.rank = append([]int(nil), node.rank...)
+	next.statics = make(map[string]*treenode, len(node.statics))
+	for k, child := range node.statics {
+		next.statics[k] = child.clone(clones)
+	}
+	next.params = make([]*treenode, len(node.params))
+	for i, child := range node.params {
+		next.params[i] = child.clone(clones)
+	}
+	if node.wildcard != nil {
+		next.wildcard = node.wildcard.clone(clones)
+	}
+
+	clones[node] = &next
+	return &next
+}
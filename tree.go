@@ -1,126 +1,661 @@
 package vi
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	neturl "net/url"
+	"regexp"
+	"sort"
 	"strings"
 )
 
-type (
-	nodeKey = string
+// Return when route register along the path can never be serve , because previous route already serve all request
+var errDuplicateRoute = errors.New("route already registered")
 
+type (
 	// represent the tree of nodes for particular route method
+	// static segments are compressed into single node , while param and wildcard segment has its own node
 	tree struct {
-		// tree root
+		// tree root , match nothing by itself
 		root *treenode
 		// tree size
 		size int
+		// leaf nodes in registration order
+		leaves []*treenode
+		// whether any route allow case insensitive matching
+		fold bool
 	}
 
-	// tree node represent the structure that hold particular identify by particular node key
-	// only leaf node  will hold the expected value in this case handler and middlewares
+	// tree node represent single path segment , or run of static segments
+	// only leaf node  will hold the expected value in this case the routes
 	treenode struct {
-		key nodeKey
+		// one of the rank constant
+		kind int
+		// static segments join by / for static node , or the param name
+		key string
+		// regex that the whole segment must match for param node
+		regex *regexp.Regexp
+		// param use the default pattern , which is check without regex
+		word bool
+		// modifier of the param , such as ? or *
+		modifier byte
+		// param can span multiple segments
+		span bool
+		// compiled form of segment that mix literal text and params
+		tpl *template
 		// the route
 		path string
-		// the handler for the router
-		handler http.HandlerFunc
-		// its depth in the routing tree
-		depth int
-		// its children treenodes
-		children map[nodeKey]*treenode
+		// routes register along the path , in registration order
+		routes []*Route
+		// static children keyed by their first segment
+		statics map[string]*treenode
+		// param children , more specific first then creation order
+		params []*treenode
+		// catch all children
+		wildcard *treenode
 		// whether treenode is leaf treenode
 		isLeaf bool
-		// middlewares register on the node
-		prefixes []string
+		// specificity of each path segment , lower is more specific
+		rank []int
+		// registration order of the leaf in the tree
+		seq int
 	}
 )
 
-// create a new treenode with specific key
-func newNode(key nodeKey, depth int) *treenode {
+// create a new treenode with specific kind and key
+func newNode(kind int, key string) *treenode {
 	return &treenode{
-		key:      key,
-		depth:    depth,
-		children: make(map[nodeKey]*treenode),
+		kind:    kind,
+		key:     key,
+		statics: make(map[string]*treenode),
 	}
 }
 
 func newTree() *tree {
 	return &tree{
-		root: newNode("/", 1),
+		root: newNode(rankLiteral, ""),
 		size: 1,
 	}
 }
 
 // add new route to the routing tree
-// create a new treenode for each char in the key
+// run of static segments share a single node , that is split when other path diverge in the middle
 // and the final treenode represent the endpoint of the route
-func (tree *tree) add(path string, handle http.HandlerFunc, prefixes []string) {
-	var treenode = tree.root
+// Return errDuplicateRoute when the previous route on the path has no matchers
+func (tree *tree) add(path string, route *Route) error {
+	segs := strings.Split(path, "/")[1:]
+	parsed := make([]segment, len(segs))
+	for i, pth := range segs {
+		seg, err := parseSegment(pth)
+		if err != nil {
+			return err
+		}
+		if seg.kind == rankWildcard && i != len(segs)-1 {
+			// named catch all in the middle consume one or more segments , like spanning param
+			if seg.name == "" {
+				return fmt.Errorf("wildcard must be the last segment in %s unless it is named", path)
+			}
+			seg.span = true
+		}
+		if seg.kind != rankLiteral && seg.kind != rankWildcard || seg.span {
+			if _, err := regexp.Compile(seg.regex); err != nil {
+				return err
+			}
+		}
+		parsed[i] = seg
+	}
 
-	if path != treenode.key {
-		path = strings.TrimPrefix(path, "/")
+	// catch all in the middle is only unambiguous when every following segment match exactly one segment
+	for i, seg := range parsed {
+		if seg.kind != rankWildcard || !seg.span {
+			continue
+		}
+		for _, next := range parsed[i+1:] {
+			if next.kind == rankWildcard || next.span || next.modifier != 0 {
+				return fmt.Errorf("wildcard *%s in %s must be followed by single segments only", seg.name, path)
+			}
+		}
+	}
 
-		for _, key := range path {
-			child, ok := treenode.children[nodeKey(key)]
-			if !ok {
-				child = newNode(nodeKey(key), treenode.depth+1)
-				treenode.children[nodeKey(key)] = child
+	node := tree.root
+	for i := 0; i < len(parsed); {
+		switch parsed[i].kind {
+		case rankLiteral:
+			j := i
+			for j < len(parsed) && parsed[j].kind == rankLiteral {
+				j++
+			}
+			node = tree.addStatic(node, segs[i:j])
+			i = j
+			continue
+		case rankWildcard:
+			if parsed[i].span {
+				node = tree.addParam(node, parsed[i])
+				break
+			}
+			if node.wildcard == nil {
+				node.wildcard = newNode(rankWildcard, parsed[i].name)
 				tree.size++
+			} else if node.wildcard.key != parsed[i].name {
+				return fmt.Errorf("wildcard *%s in %s conflict with *%s registered on the same path", parsed[i].name, path, node.wildcard.key)
+			}
+			node = node.wildcard
+		default:
+			node = tree.addParam(node, parsed[i])
+		}
+		i++
+	}
+
+	for _, rt := range node.routes {
+		if len(rt.loadMatchers()) == 0 {
+			return errDuplicateRoute
+		}
+	}
+
+	node.routes = append(node.routes, route)
+	tree.fold = tree.fold || route.casepolicy != PathStrict
+	if !node.isLeaf {
+		node.isLeaf = true
+		node.path = path
+		node.rank = rankPath(path)
+		node.seq = len(tree.leaves)
+		tree.leaves = append(tree.leaves, node)
+	}
+
+	return nil
+}
+
+// build new tree without the routes along path , return the new tree and the removed routes
+// remaining routes are re-added in registration order , so node order and priority are preserved
+func (tree *tree) without(path string) (*tree, []*Route) {
+	next := newTree()
+	var removed []*Route
+	for _, leaf := range tree.leaves {
+		if leaf.path == path {
+			removed = leaf.routes
+			continue
+		}
+		for _, rt := range leaf.routes {
+			// cannot fail , the route was already accepted by the tree
+			next.add(leaf.path, rt)
+		}
+	}
+	return next, removed
+}
+
+// add run of static segments under node , return the node that represent the last segment
+func (tree *tree) addStatic(node *treenode, segs []string) *treenode {
+	for len(segs) > 0 {
+		child, ok := node.statics[segs[0]]
+		if !ok {
+			child = newNode(rankLiteral, strings.Join(segs, "/"))
+			node.statics[segs[0]] = child
+			tree.size++
+			return child
+		}
+
+		keys := strings.Split(child.key, "/")
+		common := 1
+		for common < len(keys) && common < len(segs) && keys[common] == segs[common] {
+			common++
+		}
+
+		// diverge in the middle , split the child at the diverge point
+		if common < len(keys) {
+			parent := newNode(rankLiteral, strings.Join(keys[:common], "/"))
+			child.key = strings.Join(keys[common:], "/")
+			parent.statics[keys[common]] = child
+			node.statics[segs[0]] = parent
+			tree.size++
+			child = parent
+		}
+
+		node = child
+		segs = segs[common:]
+	}
+
+	return node
+}
+
+// add param segment under node , node with the same param is reuse
+func (tree *tree) addParam(node *treenode, seg segment) *treenode {
+	for _, child := range node.params {
+		if child.kind == seg.kind && child.key == seg.name && child.modifier == seg.modifier && child.span == seg.span && child.regex.String() == anchor(seg.regex) {
+			return child
+		}
+	}
+
+	child := newNode(seg.kind, seg.name)
+	child.regex = regexp.MustCompile(anchor(seg.regex))
+	child.word = seg.regex == `[\w]+` && !seg.span
+	child.modifier = seg.modifier
+	child.span = seg.span
+	child.tpl = seg.tpl
+	tree.size++
+
+	// keep more specific param first , then creation order
+	idx := len(node.params)
+	for i, p := range node.params {
+		if p.kind > child.kind {
+			idx = i
+			break
+		}
+	}
+	node.params = append(node.params, nil)
+	copy(node.params[idx+1:], node.params[idx:])
+	node.params[idx] = child
+
+	return child
+}
+
+// anchor the regex , so it must match the whole segment
+func anchor(regex string) string {
+	return "^(?:" + regex + ")$"
+}
+
+// whether the segment match the param node
+func (node *treenode) matchSegment(seg string) bool {
+	if node.word {
+		if seg == "" {
+			return false
+		}
+		for i := 0; i < len(seg); i++ {
+			c := seg[i]
+			if !(c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+				return false
+			}
+		}
+		return true
+	}
+	return node.regex.MatchString(seg)
+}
+
+// search hold the state of single lookup
+type search struct {
+	r   *http.Request
+	url string
+	// url is the raw path , so each captured value is decoded before matching
+	raw bool
+	// captured params are appended , and truncated when backtrack
+	params *[]Param
+	// match static segment case insensitively , only route that allow it can be found
+	fold bool
+	// static segments match with different casing , use to build the canonical path
+	fixes []fix
+}
+
+// static segments at pos that is registered as key
+type fix struct {
+	pos int
+	key string
+}
+
+// lookup the route that serve the request , url must start with /
+// at each segment static node is try first , then param nodes and finally the catch all
+// captured params are appended to params , which is left untouched when nothing match
+// raw is whether url is the raw path , param value is then decoded before it is match against the param regex
+func (tree *tree) lookup(r *http.Request, url string, raw bool, params *[]Param) *Route {
+	s := search{r: r, url: url, raw: raw, params: params}
+	return tree.search(&s)
+}
+
+// lookup the route that allow case insensitive matching , static segments are compare case insensitively
+// canonical is the url with static segments in the registered casing
+func (tree *tree) lookupFold(r *http.Request, url string, raw bool, params *[]Param) (rt *Route, canonical string) {
+	if !tree.fold {
+		return nil, ""
+	}
+
+	s := search{r: r, url: url, raw: raw, params: params, fold: true}
+	if rt = tree.search(&s); rt == nil {
+		return nil, ""
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, f := range s.fixes {
+		b.WriteString(url[last:f.pos])
+		b.WriteString(f.key)
+		last = f.pos + len(f.key)
+	}
+	b.WriteString(url[last:])
+	return rt, b.String()
+}
+
+// return the decoded value when the raw path is match , value that can not be decoded is return as is
+func (s *search) decode(value string) string {
+	if s.raw && strings.IndexByte(value, '%') >= 0 {
+		if unescaped, err := neturl.PathUnescape(value); err == nil {
+			return unescaped
+		}
+	}
+	return value
+}
+
+func (tree *tree) search(s *search) *Route {
+	if s.url == "" || s.url[0] != '/' {
+		return nil
+	}
+
+	rt := tree.root.lookup(s, 1)
+	// root url has no segment , so it can be serve by param that match zero segment
+	if rt == nil && s.url == "/" {
+		return tree.root.end(s)
+	}
+	return rt
+}
+
+// lookup the route under node , where pos is the start of the next segment in the url
+// pos beyond the url length signify all segments have been consumed
+func (node *treenode) lookup(s *search, pos int) *Route {
+	url := s.url
+	if pos > len(url) {
+		return node.end(s)
+	}
+
+	end := strings.IndexByte(url[pos:], '/')
+	if end < 0 {
+		end = len(url)
+	} else {
+		end += pos
+	}
+	seg := url[pos:end]
+
+	if s.fold {
+		if rt := node.lookupFold(s, pos, seg); rt != nil {
+			return rt
+		}
+	} else if child, ok := node.statics[seg]; ok {
+		if len(child.key) == len(seg) {
+			if rt := child.lookup(s, end+1); rt != nil {
+				return rt
 			}
+		} else if next := pos + len(child.key); strings.HasPrefix(url[pos:], child.key) && (next == len(url) || url[next] == '/') {
+			if rt := child.lookup(s, next+1); rt != nil {
+				return rt
+			}
+		}
+	}
+
+	for _, child := range node.params {
+		if rt := child.lookupParam(s, pos); rt != nil {
+			return rt
+		}
+	}
+
+	if node.wildcard != nil {
+		return node.wildcard.catchAll(s, url[pos:])
+	}
+
+	return nil
+}
+
+// lookup the static children that match seg case insensitively , child with the same casing is try first
+func (node *treenode) lookupFold(s *search, pos int, seg string) *Route {
+	var children []*treenode
+	if child, ok := node.statics[seg]; ok {
+		children = append(children, child)
+	}
+	for first, child := range node.statics {
+		if first != seg && strings.EqualFold(first, seg) {
+			children = append(children, child)
+		}
+	}
+	if len(children) > 2 {
+		sort.Slice(children[1:], func(i, j int) bool { return children[i+1].key < children[j+1].key })
+	}
+
+	for _, child := range children {
+		next := pos + len(child.key)
+		if next > len(s.url) || !strings.EqualFold(s.url[pos:next], child.key) || next != len(s.url) && s.url[next] != '/' {
+			continue
+		}
+
+		n := len(s.fixes)
+		if s.url[pos:next] != child.key {
+			s.fixes = append(s.fixes, fix{pos: pos, key: child.key})
+		}
+		if rt := child.lookup(s, next+1); rt != nil {
+			return rt
+		}
+		s.fixes = s.fixes[:n]
+	}
+	return nil
+}
 
-			treenode = child
+// all segments have been consumed , the route is found if node is leaf
+// otherwise param that can match zero segment or catch all may still match
+func (node *treenode) end(s *search) *Route {
+	if node.isLeaf {
+		if rt := node.route(s); rt != nil {
+			return rt
 		}
+	}
 
-		path = "/" + path
+	for _, child := range node.params {
+		if child.modifier == '?' || child.modifier == '*' {
+			if rt := child.end(s); rt != nil {
+				return rt
+			}
+		}
+	}
+
+	if node.wildcard != nil {
+		return node.wildcard.catchAll(s, "")
 	}
 
-	treenode.handler = handle
-	treenode.isLeaf = true
-	treenode.path = path
-	treenode.prefixes = prefixes
+	return nil
 }
 
-// find all nodes in the routing tree that match given key
-// After identify  the first matching , it continue to find  all leaf nodes with  bread first exploration
-func (tree *tree) find(key string) (nodes []*treenode) {
+// lookup the param node starting at pos
+// param with ? match at most one segment , with * and + match as many segments as possible
+// and the last matched segment is captured , similar to regex group with modifier
+func (node *treenode) lookupParam(s *search, pos int) *Route {
+	if node.span {
+		return node.lookupSpan(s, pos)
+	}
+	if node.tpl != nil {
+		return node.lookupMixed(s, pos)
+	}
+
 	var (
-		stack []*treenode
-		node  = tree.root
+		url = s.url
+		// start of each consumed segment , backed by array so short path does not allocate
+		buf    [8]int
+		starts = buf[:0]
+		next   = pos
 	)
 
-	// root
-	if key == node.path {
-		return []*treenode{node}
+	for next <= len(url) {
+		end := strings.IndexByte(url[next:], '/')
+		if end < 0 {
+			end = len(url)
+		} else {
+			end += next
+		}
+		if !node.matchSegment(s.decode(url[next:end])) {
+			break
+		}
+		starts = append(starts, next)
+		next = end + 1
+
+		if node.modifier != '*' && node.modifier != '+' {
+			break
+		}
 	}
 
-	keys := strings.TrimPrefix(key, "/")
+	least := 1
+	if node.modifier == '?' || node.modifier == '*' {
+		least = 0
+	}
 
-	for _, char := range keys {
-		child, ok := node.children[nodeKey(char)]
-		if !ok {
-			return
+	// try longest match first
+	for n := len(starts); n >= least; n-- {
+		if n == 0 {
+			if rt := node.lookup(s, pos); rt != nil {
+				return rt
+			}
+			continue
 		}
-		if key == child.path {
-			return []*treenode{child}
+
+		// end of the last consumed segment
+		end := next - 1
+		if n < len(starts) {
+			end = starts[n] - 1
 		}
 
-		node = child
+		if rt := node.capture(s, s.decode(url[starts[n-1]:end]), end+1); rt != nil {
+			return rt
+		}
 	}
 
-	// successfully match the entire key
-	stack = append(stack, node)
+	return nil
+}
 
-	for len(stack) > 0 {
-		node, stack = stack[0], stack[1:]
+// lookup the spanning param node starting at pos
+// the param consume one or more whole segments and the regex must match all of them including the /
+func (node *treenode) lookupSpan(s *search, pos int) *Route {
+	url := s.url
+	// end of each segment from pos , backed by array so short path does not allocate
+	var buf [8]int
+	ends := buf[:0]
+	for next := pos; next <= len(url); {
+		end := strings.IndexByte(url[next:], '/')
+		if end < 0 {
+			end = len(url)
+		} else {
+			end += next
+		}
+		ends = append(ends, end)
+		next = end + 1
+	}
 
-		if node.isLeaf {
-			nodes = append(nodes, node)
+	// try longest match first
+	for i := len(ends) - 1; i >= 0; i-- {
+		value := s.decode(url[pos:ends[i]])
+		if !node.regex.MatchString(value) {
+			continue
+		}
+		if rt := node.capture(s, value, ends[i]+1); rt != nil {
+			return rt
 		}
+	}
+
+	return nil
+}
+
+// lookup the node of segment that mix literal text and params , all params of the segment are captured at once
+func (node *treenode) lookupMixed(s *search, pos int) *Route {
+	url := s.url
+	if pos > len(url) {
+		return nil
+	}
+	end := strings.IndexByte(url[pos:], '/')
+	if end < 0 {
+		end = len(url)
+	} else {
+		end += pos
+	}
+
+	n := len(*s.params)
+	if !node.tpl.capture(s.decode(url[pos:end]), s.params) {
+		return nil
+	}
+	if rt := node.lookup(s, end+1); rt != nil {
+		return rt
+	}
+	*s.params = (*s.params)[:n]
+	return nil
+}
+
+// match the catch all node against the rest of the url , named catch all capture it
+func (node *treenode) catchAll(s *search, rest string) *Route {
+	if !node.isLeaf {
+		return nil
+	}
+	if node.key == "" {
+		return node.route(s)
+	}
+
+	n := len(*s.params)
+	*s.params = append(*s.params, Param{Key: node.key, Value: s.decode(rest)})
+	if rt := node.route(s); rt != nil {
+		return rt
+	}
+	*s.params = (*s.params)[:n]
+	return nil
+}
 
-		for _, vnode := range node.children {
-			stack = append(stack, vnode)
+// capture value for the param node then lookup the rest of the url from pos
+// the captured value is drop when the rest does not match , so the caller can backtrack
+func (node *treenode) capture(s *search, value string, pos int) *Route {
+	n := len(*s.params)
+	*s.params = append(*s.params, Param{Key: node.key, Value: value})
+	if rt := node.lookup(s, pos); rt != nil {
+		return rt
+	}
+	*s.params = (*s.params)[:n]
+	return nil
+}
+
+// return the path of leaf nodes that can match the same url as path
+// with the same priority , in this case registration order decide which one get serve
+func (tree *tree) ambiguous(path string) []string {
+	rank := rankPath(path)
+	if isStaticRank(rank) {
+		return nil
+	}
+
+	segments := strings.Split(path, "/")[1:]
+	var paths []string
+	for _, node := range tree.leaves {
+		if node.path == path || !equalRank(node.rank, rank) {
+			continue
+		}
+
+		// literal segment must be the same to overlap
+		overlap := true
+		for i, pth := range strings.Split(node.path, "/")[1:] {
+			if rank[i] == rankLiteral && pth != segments[i] {
+				overlap = false
+				break
+			}
+		}
+		if overlap {
+			paths = append(paths, node.path)
+		}
+	}
+
+	return paths
+}
+
+func equalRank(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// return the first route on the node that satisfy all of its matchers
+// the value captured by the matchers is appended to params
+// route that does not allow case insensitive matching is skip when folding
+func (node *treenode) route(s *search) *Route {
+	for _, rt := range node.routes {
+		if s.fold && rt.casepolicy == PathStrict {
+			continue
+		}
+		n := len(*s.params)
+		if rt.match(s.r, s.params) {
+			return rt
 		}
+		*s.params = (*s.params)[:n]
 	}
 
-	return nodes
+	return nil
 }
@@ -1,189 +1,197 @@
 package vi
 
 import (
-	"fmt"
-	"strings"
+	"net/http"
+	"net/http/httptest"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
-
-	"net/http"
 )
 
-// helper to check the  where two paths diverge , so at that point more node will be create
-// therefore node to be create =  len(newP) - level
-func divergeAt(oldP, newP string) (level int) {
-	cmap := make(map[rune]int)
-
-	for _, rs := range oldP + newP {
-		cmap[rs]++
-	}
-
-	for i, v := range oldP {
-		if cmap[v] == 1 {
-			return i
-		}
-		delete(cmap, v)
-	}
-
-	for i, v := range newP {
-		if _, ok := cmap[v]; ok {
-			level = i
-			return
-		}
-	}
-
-	return -1
-}
-
 var _ = Describe("tree: unix-test", Ordered, func() {
 	var (
-		nTree               *tree
-		root                *treenode
-		nTreeSizeInitial    int
-		nTreeSizeAfterFirst int
-		handler             http.HandlerFunc
-		path1               = "/hello"
-		path2               = "/hello2"
+		nTree *tree
+		root  *treenode
 	)
 	BeforeAll(func() {
-		handler = func(w http.ResponseWriter, r *http.Request) {
-
-			fmt.Fprint(w, "ok")
-		}
 		nTree = newTree()
 		root = nTree.root
 		Expect(nTree).To(Not(BeNil()), "tree should not be nil when initialize")
 		Expect(nTree.size).To(Equal(1), "initial tree size should be 1")
-		Expect(nTree.root.depth).To(Equal(1), "initial root depth should be 1")
-		Expect(nTree.root.children).To(BeEmpty(), "initial children of root should be 0")
-		nTreeSizeInitial = nTree.size
-
+		Expect(root.statics).To(BeEmpty(), "initial children of root should be 0")
 	})
 
-	When("Adding node , it should be reuse , added value  and order correctly to the tree", func() {
-		When("Adding initial path", func() {
-			path1Len := len(trimPrefix(path1))
-
-			mock := setupMock(handler, path1)
-
-			It(fmt.Sprintf("Should create %d nodes when adding path : %s", path1Len, path1), func() {
-
-				nTree.add(path1, mock.GetHandler(), []string{"/", "/path1"})
-				currentNtreeSize := nTree.size
-				diffLevel := divergeAt(path1, root.key)
-				if diffLevel < 0 {
-					// no diverge , so len(path) of nodes need to be create
-					diffLevel = len(path1)
-				}
-				expectSize := nTreeSizeInitial + len(path1) - diffLevel
-
-				Expect(currentNtreeSize).To(Equal(expectSize), "Tree size should be %d after create %d nodes for path : %s", expectSize, len(path1)-diffLevel, path1)
-				nTreeSizeAfterFirst = currentNtreeSize
-			})
-			It("Added correctly", func() {
-				node := root
-
-				for i, key := range trimPrefix(path1) {
-					if !node.isLeaf {
-						By("Create correct amount of  node")
-						Expect(node.children).To(HaveLen(1), fmt.Sprintf("Node %v should have a single children with %v \n", string(node.key), key))
-
-						By("Only the final node will be leaf node ")
-						Expect(node.isLeaf).To(BeFalse(), "node %v is not leaf node", string(node.key))
-						Expect(node.path).To(BeEmpty(), "node %v is not leaf node therefore path should be empty", string(node.key))
-
-						By("Added correct childrens")
-						Expect(node.depth).To(Equal(i+1), "the depth level of node %v should be %d", string(node.key), i+1)
-						children, childrenExist := node.children[nodeKey(key)]
-						Expect(childrenExist).To(BeTrue(), "the children of node %v should exist", string(node.key))
-
-						node = children
-					}
-
-				}
-
-				hlr := node.handler
-				Expect(hlr).ToNot(BeNil(), "leaf node should contain added handler")
-
-			})
+	When("Adding static path", func() {
+		It("Should compress static segments into single node", func() {
+			Expect(nTree.add("/hello/world", &Route{})).To(Succeed())
+			Expect(nTree.size).To(Equal(2))
+			Expect(root.statics).To(HaveKey("hello"))
+			Expect(root.statics["hello"].key).To(Equal("hello/world"))
+			Expect(root.statics["hello"].isLeaf).To(BeTrue())
 		})
 
-		When("Adding second path", func() {
-			mock := setupMock(handler, path2)
-
-			It("Should create the different (between len(path)  and the different of two paths) nodes only", func() {
-				nTree.add(path2, mock.GetHandler(), []string{"/", "/path2"})
-				currentSize := nTree.size
-				diffLevel := divergeAt(path1, path2)
-				if diffLevel < 0 {
-					diffLevel = len(path2)
-				}
+		It("Should split the node when path diverge in the middle", func() {
+			Expect(nTree.add("/hello/there/again", &Route{})).To(Succeed())
+			Expect(nTree.size).To(Equal(4))
+
+			hello := root.statics["hello"]
+			Expect(hello.key).To(Equal("hello"))
+			Expect(hello.isLeaf).To(BeFalse(), "node hello is not leaf node")
+			Expect(hello.path).To(BeEmpty(), "node hello is not leaf node therefore path should be empty")
+			Expect(hello.statics).To(HaveLen(2))
+			Expect(hello.statics["world"].key).To(Equal("world"))
+			Expect(hello.statics["there"].key).To(Equal("there/again"))
+		})
 
-				expectSize := nTreeSizeAfterFirst + len(path2) - diffLevel
+		It("Should reuse the node when path end in the middle", func() {
+			Expect(nTree.add("/hello", &Route{})).To(Succeed())
+			Expect(nTree.size).To(Equal(4))
 
-				Expect(currentSize).To(Equal(expectSize), "Tree size should be %d after create %d nodes for path : %s", expectSize, len(path2)-diffLevel, path2)
-			})
+			hello := root.statics["hello"]
+			Expect(hello.isLeaf).To(BeTrue())
+			Expect(hello.path).To(Equal("/hello"))
+			Expect(hello.routes).To(HaveLen(1), "leaf node should contain added route")
+		})
+	})
 
-			It("Should added correctly", func() {
-				node := root
+	When("Adding param path", func() {
+		It("Should create param node and reuse it", func() {
+			Expect(nTree.add("/hello/:name", &Route{})).To(Succeed())
+			Expect(nTree.add("/hello/:name/post", &Route{})).To(Succeed())
+			Expect(nTree.add("/hello/{id:[0-9]+}", &Route{})).To(Succeed())
+			Expect(nTree.add("/hello/*", &Route{})).To(Succeed())
+
+			hello := root.statics["hello"]
+			Expect(hello.params).To(HaveLen(2))
+			Expect(hello.params[0].key).To(Equal("id"), "regex param should come before named param")
+			Expect(hello.params[1].key).To(Equal("name"))
+			Expect(hello.params[1].statics).To(HaveKey("post"))
+			Expect(hello.wildcard).ToNot(BeNil())
+		})
 
-				diffLevel := divergeAt(path1, path2)
+		It("Should reject invalid path", func() {
+			Expect(nTree.add("/hello/*/world", &Route{})).ToNot(Succeed())
+			Expect(nTree.add("/hello/{id:[0-9}", &Route{})).ToNot(Succeed())
+			Expect(nTree.add("/hello/{}", &Route{})).ToNot(Succeed())
+		})
+	})
 
-				for i, key := range trimPrefix(path2) {
-					if !node.isLeaf {
-						By("Reuse node")
-						if i == diffLevel {
-							Expect(node.children).To(HaveLen(2), fmt.Sprintf("Node %d of key %s should be reuse, and therfore another children should be added", diffLevel, string(path2[diffLevel-1])))
-						} else {
+	DescribeTable("Finding route in the tree", func(url string, expectPath string, expectParams matchParams) {
+		var captured []Param
+		rt := nTree.lookup(httptest.NewRequest("GET", "/", http.NoBody), url, false, &captured)
+		params := toParams(captured)
+		if expectPath == "" {
+			Expect(rt).To(BeNil(), "should not return any route for %s", url)
+			return
+		}
 
-							Expect(node.children).To(HaveLen(1), "other newly added node will  have children of 1")
-						}
+		Expect(rt).ToNot(BeNil(), "should return route for %s", url)
+		Expect(nTree.leaves[indexOf(nTree.leaves, rt)].path).To(Equal(expectPath))
+		Expect(params).To(Equal(expectParams))
+	},
+		Entry("compressed static", "/hello/world", "/hello/world", nil),
+		Entry("split static", "/hello/there/again", "/hello/there/again", nil),
+		Entry("static in the middle", "/hello", "/hello", nil),
+		Entry("regex param", "/hello/101", "/hello/{id:[0-9]+}", matchParams{"id": "101"}),
+		Entry("named param", "/hello/anh", "/hello/:name", matchParams{"name": "anh"}),
+		Entry("param then static", "/hello/anh/post", "/hello/:name/post", matchParams{"name": "anh"}),
+		Entry("static prefix of compressed node", "/hello/there", "/hello/:name", matchParams{"name": "there"}),
+		Entry("no param match", "/hello/there-again", "/hello/*", nil),
+		Entry("catch all", "/hello/anh/comment/1", "/hello/*", nil),
+		Entry("not found", "/invalid", "", nil),
+		Entry("empty url", "", "", nil),
+	)
+})
 
-						By("Only the final node will be leaf node ")
-						Expect(node.isLeaf).To(BeFalse(), "node %v is not leaf node", string(node.key))
-						Expect(node.path).To(BeEmpty(), "node %v is not leaf node therefore path should be empty", string(node.key))
+// return index of the leaf that hold the route
+func indexOf(leaves []*treenode, rt *Route) int {
+	for i, leaf := range leaves {
+		for _, r := range leaf.routes {
+			if r == rt {
+				return i
+			}
+		}
+	}
+	return -1
+}
 
-						By("Added correct childrens")
-						Expect(node.depth).To(Equal(i+1), "the depth level of node %v should be %d", string(node.key), i+1)
-						children, childrenExist := node.children[nodeKey(key)]
-						Expect(childrenExist).To(BeTrue(), "the children of node %v should exist", string(node.key))
+var _ = DescribeTable("tree: param with modifier", func(path, url string, expectMatch bool, expectParams matchParams) {
+	t := newTree()
+	Expect(t.add(path, &Route{})).To(Succeed())
 
-						node = children
+	var captured []Param
+	rt := t.lookup(httptest.NewRequest("GET", "/", http.NoBody), url, false, &captured)
+	params := toParams(captured)
+	if !expectMatch {
+		Expect(rt).To(BeNil())
+		return
+	}
+	Expect(rt).ToNot(BeNil())
+	Expect(params).To(Equal(expectParams))
+},
+	Entry("optional present", "/user/:name?", "/user/anh", true, matchParams{"name": "anh"}),
+	Entry("optional absent", "/user/:name?", "/user", true, nil),
+	Entry("optional in the middle", "/user/:name?/:id", "/user/101", true, matchParams{"id": "101"}),
+	Entry("optional in the middle present", "/user/:name?/:id", "/user/anh/101", true, matchParams{"name": "anh", "id": "101"}),
+	Entry("star repeat capture last", "/user/:name*", "/user/a/b/c", true, matchParams{"name": "c"}),
+	Entry("star absent", "/user/:name*", "/user", true, nil),
+	Entry("plus absent", "/user/:name+", "/user", false, nil),
+	Entry("plus backtrack", "/user/:name+/edit", "/user/a/b/edit", true, matchParams{"name": "b"}),
+	Entry("anchored segment", "/user/:id", "/user/101abc", false, nil),
+	Entry("anchored path", "/user/:name", "/api/user/anh", false, nil),
+	Entry("trailing segment", "/user/:name", "/user/anh/extra", false, nil),
+	Entry("spanning param", "/file/{path...}", "/file/a/b/c", true, matchParams{"path": "a/b/c"}),
+	Entry("spanning param with regex", `/file/{path...:.+\.js}`, "/file/a/b.css", false, nil),
+	Entry("optional root", "/:name?", "/", true, nil),
+	Entry("root", "/", "/", true, nil),
+	Entry("root catch all", "/*", "/", true, nil),
+)
 
-					}
+var _ = Describe("tree: priority and conflict", func() {
+	It("Should not allow catch all with different name on the same path", func() {
+		t := newTree()
+		Expect(t.add("/files/*path", &Route{})).To(Succeed())
+		Expect(t.add("/files/*rest", &Route{})).ToNot(Succeed())
+		Expect(t.add("/files/*", &Route{})).ToNot(Succeed())
+		Expect(t.add("/files/*path/raw", &Route{})).To(Succeed())
+	})
 
-				}
+	DescribeTable("Should match by specificity then registration order", func(url, expectPath string) {
+		for i := 0; i < 10; i++ {
+			t := newTree()
+			for _, path := range []string{"/*", "/user/:name?", "/user/:name", "/user/{id:[0-9]+}", "/user", "/user/:slug"} {
+				Expect(t.add(path, &Route{path: path})).To(Succeed())
+			}
 
-				hlr := node.handler
-				Expect(hlr).ToNot(BeNil(), "leaf node should contain added handler")
-			})
-		})
+			rt := t.lookup(httptest.NewRequest("GET", url, http.NoBody), url, false, new([]Param))
+			Expect(rt).ToNot(BeNil())
+			Expect(rt.path).To(Equal(expectPath))
+		}
+	},
+		Entry("static", "/user", "/user"),
+		Entry("regex", "/user/101", "/user/{id:[0-9]+}"),
+		Entry("named param registered first", "/user/anh", "/user/:name"),
+		Entry("optional param", "/user/anh-dion", "/*"),
+		Entry("wildcard", "/video/anh", "/*"),
+	)
 
+	It("Should reject duplicate route unless previous route has matchers", func() {
+		t := newTree()
+		secure := new(Route)
+		secure.matchers.Store(&[]matcher{schemeMatcher{"https"}})
+		Expect(t.add("/user", secure)).To(Succeed())
+		Expect(t.add("/user", &Route{})).To(Succeed())
+		Expect(t.add("/user", &Route{})).To(MatchError(errDuplicateRoute))
 	})
 
-	When("Finding node in the tree", func() {
-		It("Should return matches node", func() {
-			By("Finding nodes for the first path")
-			nodes := nTree.find(path1)
-			Expect(nodes).ToNot(BeNil(), fmt.Sprintf("nodes for %s should not be nil", path1))
-			Expect(nodes).To(HaveLen(1), "return matchexact path hello")
-			Expect(string(nodes[0].key)).To(Equal("o"), "last element of path1 is o")
-			By("Finding nodes for the second path")
-			nodes = nTree.find(path2)
-			Expect(nodes).ToNot(BeNil(), fmt.Sprintf("nodes for %s should not be nil", path2))
-			Expect(nodes).To(HaveLen(1), "expect path hello2 to match only handler for hello2 not hello")
-			Expect(string(nodes[0].key)).To(Equal("2"))
-			By("Finding nodes for invalid path")
-			nodes = nTree.find("invalid")
-			Expect(nodes).To(BeEmpty(), "should not return any nodes for invalid path")
-
-		})
+	It("Should report ambiguous pattern", func() {
+		t := newTree()
+		for _, path := range []string{"/user/{id:[0-9]+}", "/user/:name", "/post/{slug:[a-z]+}"} {
+			Expect(t.add(path, &Route{})).To(Succeed())
+		}
 
+		Expect(t.ambiguous("/user/{slug:[a-z0-9]+}")).To(Equal([]string{"/user/{id:[0-9]+}"}))
+		Expect(t.ambiguous("/user/:name/:id")).To(BeEmpty())
+		Expect(t.ambiguous("/user")).To(BeEmpty())
 	})
-
 })
-
-func trimPrefix(path string) string {
-	return strings.Trim(path, "/")
-}
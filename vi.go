@@ -1,17 +1,11 @@
 package vi
 
 import (
-	"bufio"
-	"context"
-	"errors"
 	"fmt"
 	"github.com/diontr00/vi/internal/color"
-	"github.com/diontr00/vi/internal/utils"
-	"io/fs"
 	"log"
 	"net/http"
-	ospath "path"
-	"strconv"
+	"sort"
 	"strings"
 )
 
@@ -27,92 +21,128 @@ type Config struct {
 	Banner bool
 	// Set the custom not found error handler , if not set the default not fault will be use
 	NotFoundHandler http.HandlerFunc
+	// Set the custom method not allowed handler , call when the path is registered under other methods only.
+	// The Allow header is already set when the handler is call , if not set the default 405 handler will be use
+	MethodNotAllowedHandler http.HandlerFunc
+	// When set to true , HEAD request will no longer be serve by the GET handler
+	DisableAutoHead bool
+	// When set to true , OPTIONS request will no longer be answer automatically with the Allow header
+	DisableAutoOptions bool
+	// Decide how request that only differ from registered route by the trailing slash is handle , default is PathStrict
+	TrailingSlash PathPolicy
+	// Decide how request path with . , .. or duplicate slashes is handle , default is PathStrict
+	// Unless PathStrict , such path is never match as is
+	CleanPath PathPolicy
+	// When set to true , route is match against r.URL.RawPath when it is set , so encoded slash %2F in param does not split the segment
+	// Each path param is decoded before it is match against the param regex
+	UseRawPath bool
+	// Decide how request path that only differ from registered route by the casing of static segments is handle , default is PathStrict
+	// Param and regex segments are always match with the exact casing , and param keep the casing of the request
+	// Use vi.CaseInsensitive to set it for a group only
+	CaseInsensitive PathPolicy
+	// Maximum size in byte of the request body validated against the OpenAPI document , larger body is answer with 413
+	// Optional default to 1 MiB , negative value disable the limit
+	MaxBodySize int64
 }
 
-// Static defines configuration options when defining static route
-type StaticConfig struct {
-	// Root is a filesystem  that provides access to a
-	// collection of files and directories , use http.Dir("folder name") or embed FS  with http.FS()
-	// Required
-	Root http.FileSystem
-	// Defines prefix that will be add to be when reading a file from FileSystem
-	// Use only when using go embed FS for Root
-	// Optional  default to ""
-	Prefix string
-	// Name of the index file for serving
-	// Optional default to index.html
-	Index string
-	// The value for the cache-control HTTP-Header when response , its define in term of second , default value to 0
-	// Optional default to 0
-	MaxAge int
-	//  Next defines a function  that allow to skip a scenario when it return true
-	// Optional default to nil
-	Next func(w http.ResponseWriter, r *http.Request) bool
-	// File to return if path is not found. Useful for SPA's
-	// Optional default to 404 not found
-	NotFoundFile string
-}
+// default maximum size of the request body validated against the OpenAPI document
+const defaultMaxBodySize = 1 << 20
 
 type middleware func(next http.HandlerFunc) http.HandlerFunc
 
 type vi struct {
-	// hold prefix that relevant for particular vi instance
-	prefixes []string
-	// routing tree
-	trees map[string]*tree
-	// map between prefix and middleware
-	middlewares map[string][]middleware
-	// not found error handler
-	notfoundhandler http.HandlerFunc
+	// middleware scope that route registered on this instance belong to
+	scope *scope
+	// policy for path that differ by the casing , for route registered on this instance
+	casepolicy PathPolicy
+	// state shared with the groups
+	*router
 }
 
 // Return new vi
 func New(config *Config) *vi {
-	v := new(vi)
-	v.prefixes = []string{"/"}
-	v.middlewares = map[string][]middleware{"/": {}}
-	v.trees = make(map[string]*tree)
+	v := &vi{router: new(router)}
+	v.scope = &scope{prefix: "/"}
+	v.table.Store(newTable())
+	v.autohead = config == nil || !config.DisableAutoHead
+	v.autooptions = config == nil || !config.DisableAutoOptions
+	v.maxbodysize = defaultMaxBodySize
+	if config != nil {
+		v.trailingslash = config.TrailingSlash
+		v.cleanpath = config.CleanPath
+		v.rawpath = config.UseRawPath
+		v.casepolicy = config.CaseInsensitive
+		if config.MaxBodySize != 0 {
+			v.maxbodysize = config.MaxBodySize
+		}
+	}
 
 	if config != nil && config.Banner {
 		fmt.Println(color.Green(banner, color.Blue(Version), color.Red(website)))
 	}
-	if config.NotFoundHandler != nil {
+	if config != nil && config.NotFoundHandler != nil {
 		v.notfoundhandler = config.NotFoundHandler
 	} else {
 		v.notfoundhandler = func(w http.ResponseWriter, r *http.Request) {
 			http.NotFound(w, r)
 		}
 	}
+	if config != nil && config.MethodNotAllowedHandler != nil {
+		v.methodnotallowedhandler = config.MethodNotAllowedHandler
+	} else {
+		v.methodnotallowedhandler = func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	}
 	return v
 }
 
 // HTTP get routing along "pattern"
-func (v *vi) GET(path string, handler http.HandlerFunc) {
-	v.Add("GET", path, handler)
+func (v *vi) GET(path string, handler http.HandlerFunc, middlewares ...middleware) *Route {
+	return v.Add("GET", path, handler, middlewares...)
 }
 
 // HTTP post routing along "pattern"
-func (v *vi) POST(path string, handler http.HandlerFunc) {
-	v.Add("POST", path, handler)
+func (v *vi) POST(path string, handler http.HandlerFunc, middlewares ...middleware) *Route {
+	return v.Add("POST", path, handler, middlewares...)
 }
 
 // HTTP put routing along "pattern"
-func (v *vi) PUT(path string, handler http.HandlerFunc) {
-	v.Add("PUT", path, handler)
+func (v *vi) PUT(path string, handler http.HandlerFunc, middlewares ...middleware) *Route {
+	return v.Add("PUT", path, handler, middlewares...)
 }
 
 // HTTP delete routing along "pattern"
-func (v *vi) DELETE(path string, handler http.HandlerFunc) {
-	v.Add("DELETE", path, handler)
+func (v *vi) DELETE(path string, handler http.HandlerFunc, middlewares ...middleware) *Route {
+	return v.Add("DELETE", path, handler, middlewares...)
 }
 
 // HTTP path routin  along "pattern"
-func (v *vi) PATCH(path string, handler http.HandlerFunc) {
-	v.Add("PATCH", path, handler)
+func (v *vi) PATCH(path string, handler http.HandlerFunc, middlewares ...middleware) *Route {
+	return v.Add("PATCH", path, handler, middlewares...)
+}
+
+// HTTP head routing along "pattern" , take precedence over the GET handler
+func (v *vi) HEAD(path string, handler http.HandlerFunc, middlewares ...middleware) *Route {
+	return v.Add("HEAD", path, handler, middlewares...)
+}
+
+// HTTP options routing along "pattern" , take precedence over the automatic OPTIONS response
+func (v *vi) OPTIONS(path string, handler http.HandlerFunc, middlewares ...middleware) *Route {
+	return v.Add("OPTIONS", path, handler, middlewares...)
+}
+
+// Opt-in prefix matching , register the route that serve every path under prefix
+// the prefix must match whole segments , so /api match /api and /api/users but not /apiv2
+// Useful to mount other handler , since pattern otherwise must match the whole path
+func (v *vi) Prefix(method, prefix string, handler http.HandlerFunc, middlewares ...middleware) *Route {
+	return v.Add(method, strings.TrimSuffix(prefix, "/")+"/*", handler, middlewares...)
 }
 
 // register new  HTTP verb routing along pattern
-func (v *vi) Add(method, path string, handler http.HandlerFunc) {
+// Return the registered route , that can be use to name the route
+// middlewares only apply to this route , and run after the middlewares of the group
+func (v *vi) Add(method, path string, handler http.HandlerFunc, middlewares ...middleware) *Route {
 	if method == "" {
 		panic(color.Red("method must not be empty"))
 	}
@@ -126,226 +156,320 @@ func (v *vi) Add(method, path string, handler http.HandlerFunc) {
 	if handler == nil {
 		panic(color.Red("handler must not be nil"))
 	}
-
-	if v.trees == nil {
-		v.trees = make(map[string]*tree)
+	if v.cleanpath != PathStrict && cleanPath(path) != path {
+		log.Print(color.Red("[Warning] , %s %s is not clean , it will never be match when CleanPath is enabled \n", method, path))
 	}
 
-	tree := v.trees[method]
-	if tree == nil {
-		tree = newTree()
-		v.trees[method] = tree
-	}
+	route := &Route{method: method, path: path, params: pathParams(path), rank: rankPath(path), scope: v.scope, middlewares: middlewares, casepolicy: v.casepolicy, router: v.router}
+	route.handler.Store(&handler)
+	v.update(func(t *table) {
+		tree := newTree()
+		if t.trees[method] != nil {
+			tree = t.trees[method].clone()
+		}
+		t.trees[method] = tree
+
+		if err := tree.add(path, route); err != nil {
+			panic(color.Red("%s %s : %v", method, path, err))
+		}
+		t.build(route)
+		for _, other := range tree.ambiguous(path) {
+			log.Print(color.Red("[Warning] , %s %s overlap with %s , the route registered first will be serve \n", method, path, other))
+		}
+	})
 
-	tree.add(path, handler, v.prefixes)
+	return route
 }
 
-func (v *vi) registerStatic(path string, cfg *StaticConfig) {
-	cacheControl := "public, max-age=" + strconv.Itoa(cfg.MaxAge)
+// Remove all routes registered along the pattern for the method , path must be the same pattern use to register the route
+// Request that already being serve by the removed route will still complete
+// Return ErrRouteNotFound if there is no route along the path
+func (v *vi) Remove(method, path string) error {
+	if path == "" || path[0] != '/' {
+		path = "/" + path
+	}
 
-	handler := func(w http.ResponseWriter, r *http.Request) {
-		if cfg.Next != nil && cfg.Next(w, r) {
-			w.WriteHeader(http.StatusNoContent)
+	var err error
+	v.update(func(t *table) {
+		tree, ok := t.trees[method]
+		if !ok {
+			err = fmt.Errorf("%w : %s %s", ErrRouteNotFound, method, path)
 			return
 		}
 
-		// path to search for static files
-		var searchp string = ospath.Clean(r.URL.Path)
-
-		if cfg.Prefix != "" {
-			searchp = cfg.Prefix + searchp
-		}
-		if len(searchp) > 1 {
-			searchp = strings.TrimSuffix(searchp, "/")
+		next, removed := tree.without(path)
+		if len(removed) == 0 {
+			err = fmt.Errorf("%w : %s %s", ErrRouteNotFound, method, path)
+			return
 		}
-
-		if cfg.MaxAge > 0 {
-			w.Header().Set("Cache-Control", cacheControl)
+		if len(next.leaves) == 0 {
+			delete(t.trees, method)
+		} else {
+			t.trees[method] = next
 		}
 
-		file, err := cfg.Root.Open(searchp)
-		if err != nil {
-			if errors.Is(err, fs.ErrNotExist) {
-				w.WriteHeader(http.StatusNotFound)
-				w.Header().Set("Content-Type", "text/plain")
-				if cfg.NotFoundFile == "" {
-					w.Write([]byte("404 Not Found"))
-					return
-				}
-
-				nffile, err := cfg.Root.Open(cfg.NotFoundFile)
-				if err != nil {
-					w.Write([]byte("404 Not Found"))
-					log.Print(color.Red("[Warning] , not found file couldn't be open : %v \n", err))
-
-					return
-				}
-
-				defer nffile.Close()
-				w.Header().Set("Content-Type", utils.GetMIME(utils.GetFileExtension(cfg.NotFoundFile)))
-				bufio.NewReader(nffile).WriteTo(w)
-				return
-			} else {
-				w.WriteHeader(http.StatusInternalServerError)
-				w.Header().Set("Content-Type", "text/plain")
-				w.Write([]byte("500 server internal error"))
-				log.Print(color.Red("[Error] , could not open file %s for reading : %v \n", color.Bold(searchp), err))
-				return
+		for _, rt := range removed {
+			if rt.name != "" && t.named[rt.name] == rt {
+				delete(t.named, rt.name)
 			}
 		}
+	})
 
-		defer file.Close()
-		stat, _ := file.Stat()
+	return err
+}
 
-		// Serve index if path is directory
-		if stat.IsDir() {
-			index, err := cfg.Root.Open(cfg.Index)
-			if err != nil {
-				log.Panicf(color.Red("Index file couldn't be open : %v \n", err))
-			}
+// Replace the handler of all routes registered along the pattern for the method
+// name , matchers and middlewares of the routes are kept , request that already being serve use the previous handler
+// Return ErrRouteNotFound if there is no route along the path
+func (v *vi) Replace(method, path string, handler http.HandlerFunc) error {
+	if handler == nil {
+		panic(color.Red("handler must not be nil"))
+	}
+	if path == "" || path[0] != '/' {
+		path = "/" + path
+	}
 
-			defer index.Close()
-			file = index
-			searchp = cfg.Index
-		}
+	v.mu.Lock()
+	defer v.mu.Unlock()
 
-		mimeType := utils.GetFileExtension(searchp)
-		w.Header().Set("Content-Type", utils.GetMIME(mimeType))
-		if cfg.MaxAge > 0 {
-			w.Header().Set("Cache-Control", cacheControl)
+	if tree, ok := v.table.Load().trees[method]; ok {
+		for _, leaf := range tree.leaves {
+			if leaf.path != path {
+				continue
+			}
+			for _, rt := range leaf.routes {
+				rt.handler.Store(&handler)
+				v.table.Load().build(rt)
+			}
+			return nil
 		}
-
-		bufio.NewReader(file).WriteTo(w)
 	}
-	v.Add(http.MethodGet, path, handler)
-}
 
-// Static will create a file server serving the static file
-// if path present the path pattern
-func (v *vi) Static(path string, config *StaticConfig) {
-	var cfg = &StaticConfig{
-		Index:        "/index.html",
-		MaxAge:       0,
-		Next:         nil,
-		NotFoundFile: "",
-		Root:         nil,
-		Prefix:       "",
-	}
+	return fmt.Errorf("%w : %s %s", ErrRouteNotFound, method, path)
+}
 
-	if config != nil {
-		cfg = config
-		if config.Index == "" {
-			cfg.Index = "index.html"
-		}
-		if !strings.HasPrefix(cfg.Index, "/") {
-			cfg.Index = "/" + cfg.Index
-		}
-		if cfg.NotFoundFile != "" && !strings.HasPrefix(cfg.NotFoundFile, "/") {
-			cfg.NotFoundFile = "/" + cfg.NotFoundFile
-		}
+// Swap atomically replace all routes and middlewares with the one registered on next
+// so the whole routing table can be build separately then swap into running instance
+// Request that already being serve will complete with the previous table , config of v such as not found handler is kept
+// Routes of next now belong to v , next should not be use after swap
+func (v *vi) Swap(next *vi) {
+	if next == nil || next.router == v.router {
+		return
 	}
 
-	if cfg.Root == nil {
-		panic("Http file server root cannot be nil")
-	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	next.mu.Lock()
+	defer next.mu.Unlock()
 
-	if cfg.Prefix != "" && !strings.HasPrefix(cfg.Prefix, "/") {
-		cfg.Prefix = "/" + cfg.Prefix
-	}
-	v.registerStatic(path, cfg)
+	// clone , since the middlewares of next are moved to the scope of v
+	t := next.table.Load().clone()
+	t.adopt(v.router, next.scope.root(), v.scope.root())
+	v.table.Store(t)
 }
 
-// use to group route under prefix
+// use to group route under prefix , the group has its own middleware scope
+// middlewares registered on the group apply to routes of the group and its nested groups only
 func (v *vi) Group(prefix string) *vi {
 	if string(prefix[0]) != "/" {
 		prefix = "/" + prefix
 	}
-	prefixes := v.prefixes
 
-	if _, ok := v.middlewares[prefix]; !ok {
-		v.middlewares[prefix] = make([]middleware, 0)
-		prefixes = append(prefixes, prefix)
+	return &vi{
+		scope:      &scope{parent: v.scope, prefix: prefix},
+		casepolicy: v.casepolicy,
+		router:     v.router,
 	}
+}
 
+// Return the vi that register route with the case insensitive policy , route registered on v is not affected
+// Use it on group to match only the routes of the group case insensitively
+func (v *vi) CaseInsensitive(policy PathPolicy) *vi {
 	return &vi{
-		prefixes:        prefixes,
-		trees:           v.trees,
-		middlewares:     v.middlewares,
-		notfoundhandler: v.notfoundhandler,
+		scope:      v.scope,
+		casepolicy: policy,
+		router:     v.router,
 	}
 }
 
-// use to register middlewares
-func (v *vi) Use(middlewares ...middleware) {
-	// get the last prefix added
-	prefix := v.prefixes[len(v.prefixes)-1]
+// Return the vi that register route with the middlewares , after the middlewares of v
+// route registered on v is not affected
+func (v *vi) With(middlewares ...middleware) *vi {
+	s := &scope{parent: v.scope}
+	if len(middlewares) > 0 {
+		v.update(func(t *table) {
+			t.middlewares[s] = append([]middleware(nil), middlewares...)
+		})
+	}
+
+	return &vi{
+		scope:      s,
+		casepolicy: v.casepolicy,
+		router:     v.router,
+	}
+}
 
+// use to register middlewares , apply to routes of the scope including the one already registered
+func (v *vi) Use(middlewares ...middleware) {
 	if len(middlewares) > 0 {
-		v.middlewares[prefix] = append(v.middlewares[prefix], middlewares...)
+		v.update(func(t *table) {
+			// copy , since the slice is share with the previous table
+			t.middlewares[v.scope] = append(append([]middleware(nil), t.middlewares[v.scope]...), middlewares...)
+			t.rebuild(v.scope)
+		})
+	}
+}
+
+// Get the matched  param that store inside request context
+// Return empty string for both absent and empty param , use Lookup to distinguish them
+// Params are only valid until the handler return , copy the value if it is needed after that
+func GetParam(r *http.Request, key string) (paramValue string) {
+	paramValue, _ = Lookup(r, key)
+	return paramValue
+}
+
+// lookup the route that serve the request at path inside the method tree , return nil if nothing match
+// captured params are appended to params , raw is whether path is the raw path
+func (t *table) lookup(method string, r *http.Request, path string, raw bool, params *[]Param) *Route {
+	tree, ok := t.trees[method]
+	if !ok {
+		return nil
 	}
+
+	return tree.lookup(r, path, raw, params)
 }
 
-// chain all middlewares associate with prefixes
-func (v *vi) chain(w http.ResponseWriter, r *http.Request, handler http.HandlerFunc, prefixes []string) {
-	var allMiddleware []middleware
-	for _, p := range prefixes {
-		allMiddleware = append(allMiddleware, v.middlewares[p]...)
+// resolve the route that serve the request , HEAD request fallback to GET route when no HEAD route match
+// the GET handler is call with the original writer , net/http discard the body of HEAD response itself
+// route that serve every method is serve instead when it is more specific , such as mount under the catch all
+func (v *vi) resolve(t *table, r *http.Request, path string, raw bool, params *[]Param) *Route {
+	base := len(*params)
+	route := t.lookup(r.Method, r, path, raw, params)
+	if route == nil && r.Method == http.MethodHead && v.autohead {
+		route = t.lookup(http.MethodGet, r, path, raw, params)
+	}
+	if _, ok := t.trees[methodAny]; !ok {
+		return route
 	}
 
-	for i := len(allMiddleware) - 1; i >= 0; i-- {
-		handler = allMiddleware[i](handler)
+	n := len(*params)
+	every := t.lookup(methodAny, r, path, raw, params)
+	switch {
+	case every == nil:
+	case route == nil:
+		route = every
+	case moreSpecific(every.rank, route.rank):
+		// keep only the params captured by the route that serve every method
+		*params = append((*params)[:base], (*params)[n:]...)
+		route = every
+	default:
+		*params = (*params)[:n]
 	}
 
-	handler(w, r)
+	return route
 }
 
-// Get the matched  param that store inside request context
-func GetParam(r *http.Request, key string) (paramValue string) {
-	values, ok := r.Context().Value(contextKey).(matchParams)
-	if ok {
-		paramValue, ok = values[matchKey(key)]
+// Match return the route that would serve the request , false if there is none
+func (v *vi) Match(r *http.Request) (*Route, bool) {
+	rp := paramsPool.Get().(*routeParams)
+	defer rp.release()
+
+	path, raw := v.routingPath(r)
+	route := v.resolve(v.table.Load(), r, path, raw, &rp.values)
+	return route, route != nil
+}
+
+// allowed return the sorted methods that have a route registered for the request
+// including the HEAD and OPTIONS method that are answer automatically
+// params is only use as scratch buffer for the lookup
+func (v *vi) allowed(t *table, r *http.Request, path string, raw bool, params *[]Param) []string {
+	var methods []string
+	var hasHead, hasOptions bool
+	for method := range t.trees {
+		if method == methodAny {
+			continue
+		}
+		*params = (*params)[:0]
+		if route := t.lookup(method, r, path, raw, params); route != nil {
+			methods = append(methods, method)
+			hasHead = hasHead || method == http.MethodHead
+			hasOptions = hasOptions || method == http.MethodOptions
+		}
+	}
+	if len(methods) == 0 {
+		return nil
 	}
 
-	if !ok {
-		paramValue = ""
+	if v.autohead && !hasHead {
+		for _, method := range methods {
+			if method == http.MethodGet {
+				methods = append(methods, http.MethodHead)
+				break
+			}
+		}
 	}
+	if v.autooptions && !hasOptions {
+		methods = append(methods, http.MethodOptions)
+	}
+	sort.Strings(methods)
 
-	return paramValue
+	return methods
 }
 
 func (v *vi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	rqUrl := r.URL.Path
-	if _, ok := v.trees[r.Method]; !ok {
-		v.trees[r.Method] = newTree()
-	}
-	nodes := v.trees[r.Method].find(rqUrl)
-	for i := range nodes {
-		handler := nodes[i].handler
-		if handler != nil {
-			if nodes[i].path == rqUrl {
-				v.chain(w, r, handler, nodes[i].prefixes)
-				return
-			}
+	// snapshot of the routing table , stay the same for the whole request
+	t := v.table.Load()
+
+	path, raw := v.routingPath(r)
+	if v.cleanpath != PathStrict {
+		if cleaned := cleanPath(path); cleaned != path {
+			v.fixPath(w, r, cleaned, raw, v.cleanpath)
+			return
 		}
 	}
 
-	if nodes == nil {
-		// match against any regex match
-		nodes := v.trees[r.Method].find("/")
+	// params are captured into pooled buffer , which is put back once the request is serve
+	rp := paramsPool.Get().(*routeParams)
 
-		for i := range nodes {
-			handler := nodes[i].handler
+	route := v.resolve(t, r, path, raw, &rp.values)
 
-			if handler != nil {
-				isMatch, matchParams := match(rqUrl, nodes[i].path)
-				if isMatch {
-					ctx := context.WithValue(r.Context(), contextKey, matchParams)
-					r = r.WithContext(ctx)
-					v.chain(w, r, handler, nodes[i].prefixes)
-					return
-				}
-			}
+	if route != nil {
+		if len(rp.values) > 0 {
+			rp.route = route
+			r = r.WithContext(&paramsContext{Context: r.Context(), params: rp})
+		}
+		route.loadChain()(w, r)
+		rp.release()
+		return
+	}
+
+	// path exist in other casing
+	if route, canonical := v.fold(t, r, path, raw); route != nil && canonical != path {
+		rp.release()
+		v.fixPath(w, r, canonical, raw, route.casepolicy)
+		return
+	}
+
+	// path exist in the other form
+	if v.trailingslash != PathStrict && path != "/" {
+		if alt := toggleSlash(path); v.exists(t, r, alt, raw) {
+			rp.release()
+			v.fixPath(w, r, alt, raw, v.trailingslash)
+			return
+		}
+	}
+
+	// path exist under other methods
+	methods := v.allowed(t, r, path, raw, &rp.values)
+	rp.release()
+	if len(methods) > 0 {
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		if r.Method == http.MethodOptions && v.autooptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
 		}
+		v.methodnotallowedhandler(w, r)
+		return
 	}
 
 	v.notfoundhandler(w, r)
@@ -1,28 +1,15 @@
 package vi_test
 
 import (
-	"fmt"
-	"github.com/diontr00/vi"
-	"github.com/gorilla/mux"
-	. "github.com/onsi/ginkgo/v2"
-	"github.com/onsi/gomega/gmeasure"
 	"net/http"
-	"net/http/httptest"
-	"runtime"
-	"time"
-)
+	"regexp"
+	"strconv"
+	"testing"
 
-var (
-	viMux         http.Handler
-	gorillaMux    http.Handler
-	httpRouterMux http.Handler
+	"github.com/diontr00/vi"
+	"github.com/gorilla/mux"
 )
 
-type comparee struct {
-	muxName string
-	mux     http.Handler
-}
-
 type route struct {
 	method string
 	path   string
@@ -268,64 +255,131 @@ var githubRoute = []route{
 	{"DELETE", "/user/keys/{id:[0-9]+}"},
 }
 
-var _ = Describe("Performance Comparison", Ordered, func() {
-	BeforeAll(func() {
-		fmt.Printf("Run benchmark with %d Github API routes \n", len(githubRoute))
-		simpleHandler := func(w http.ResponseWriter, r *http.Request) {
-			w.WriteHeader(200)
+// match param in gorilla syntax
+var gorillaParam = regexp.MustCompile(`\{([a-z_]+)(:[^}]+)?\}`)
+
+// writer that discard everything , so only the routing is measure
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *discardWriter) WriteHeader(int) {}
+
+func simpleHandler(w http.ResponseWriter, r *http.Request) {}
+
+// convert {name} without regex into vi named param :name
+func viPath(path string) string {
+	return gorillaParam.ReplaceAllStringFunc(path, func(p string) string {
+		if sub := gorillaParam.FindStringSubmatch(p); sub[2] == "" {
+			return ":" + sub[1]
 		}
+		return p
+	})
+}
+
+// replace each param with value that match all of the param pattern
+func requestPath(path string) string {
+	return gorillaParam.ReplaceAllString(path, "101")
+}
 
-		experiment := gmeasure.NewExperiment("Memory Usage")
-		AddReportEntry(experiment.Name, experiment)
+func loadVi(routes []route) http.Handler {
+	v := vi.New(&vi.Config{Banner: false})
+	for _, route := range routes {
+		v.Add(route.method, viPath(route.path), simpleHandler)
+	}
+	return v
+}
 
-		memProfile("Vi", experiment, func() {
-			vmux := vi.New(&vi.Config{Banner: false})
-			for _, route := range githubRoute {
-				vmux.Add(route.method, route.path, simpleHandler)
-			}
-			viMux = vmux
-		})
-		memProfile("Gorilla", experiment, func() {
-			gmux := mux.NewRouter()
-			for _, route := range githubRoute {
-				gmux.HandleFunc(route.path, simpleHandler).Methods(route.method)
+func loadGorilla(routes []route) http.Handler {
+	m := mux.NewRouter()
+	for _, route := range routes {
+		m.HandleFunc(route.path, simpleHandler).Methods(route.method)
+	}
+	return m
+}
+
+func benchRoutes(b *testing.B, routes []route) {
+	requests := make([]*http.Request, len(routes))
+	for i, route := range routes {
+		r, err := http.NewRequest(route.method, requestPath(route.path), http.NoBody)
+		if err != nil {
+			b.Fatal(err)
+		}
+		requests[i] = r
+	}
+
+	muxes := []struct {
+		name string
+		mux  http.Handler
+	}{
+		{"Vi", loadVi(githubRoute)},
+		{"Gorilla", loadGorilla(githubRoute)},
+	}
+
+	for _, m := range muxes {
+		b.Run(m.name, func(b *testing.B) {
+			w := &discardWriter{header: http.Header{}}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, r := range requests {
+					m.mux.ServeHTTP(w, r)
+				}
 			}
-			gorillaMux = gmux
 		})
+	}
+}
 
-	})
-	It("Speed Comparison Vi", func() {
-		experiment := gmeasure.NewExperiment("Speed Comparison")
-		AddReportEntry(experiment.Name, experiment)
-		compares := []comparee{{muxName: "Vi", mux: viMux}, {muxName: "Gorrila", mux: gorillaMux}}
+func BenchmarkGithubStatic(b *testing.B) {
+	benchRoutes(b, []route{{"GET", "/user/repos"}})
+}
 
-		timer := experiment.NewStopwatch()
-		for _, comparee := range compares {
-			timer.Reset()
-			experiment.SampleDuration(comparee.muxName, func(idx int) {
-				for _, route := range githubRoute {
-					comparee.mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(route.method, route.path, http.NoBody))
-				}
-			}, gmeasure.SamplingConfig{N: 200, Duration: time.Second * 10, NumParallel: 16})
-			timer.Record(comparee.muxName)
+func BenchmarkGithubParam(b *testing.B) {
+	benchRoutes(b, []route{{"GET", "/repos/{owner}/{repo}/stargazers"}})
+}
 
-		}
+func BenchmarkGithubParamWithRegex(b *testing.B) {
+	benchRoutes(b, []route{{"GET", "/notifications/threads/{id:[0-9]+}/subscription"}})
+}
 
-	})
+func BenchmarkGithubAll(b *testing.B) {
+	benchRoutes(b, githubRoute)
+}
 
-})
+// allocation should be the same no matter how many params are captured
+func BenchmarkParams(b *testing.B) {
+	for _, n := range []int{0, 1, 5, 10} {
+		path, url := "", ""
+		for i := 0; i < n; i++ {
+			path += "/:p" + strconv.Itoa(i)
+			url += "/" + strconv.Itoa(i)
+		}
+		path, url = "/params"+path, "/params"+url
+
+		v := vi.New(&vi.Config{Banner: false})
+		v.GET(path, func(w http.ResponseWriter, r *http.Request) {
+			vi.GetParam(r, "p0")
+		})
+		r, err := http.NewRequest("GET", url, http.NoBody)
+		if err != nil {
+			b.Fatal(err)
+		}
 
-func memProfile(muxName string, experiment *gmeasure.Experiment, load func()) {
-	var memcal = func(idx int) float64 {
-		m := new(runtime.MemStats)
-		runtime.GC()
-		runtime.ReadMemStats(m)
-		before := m.HeapAlloc
-		load()
-		runtime.GC()
-		runtime.ReadMemStats(m)
-		after := m.HeapAlloc
-		return float64(after - before)
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			w := &discardWriter{header: http.Header{}}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				v.ServeHTTP(w, r)
+			}
+		})
 	}
-	experiment.SampleValue(muxName, memcal, gmeasure.SamplingConfig{N: 1})
 }
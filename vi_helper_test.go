@@ -10,8 +10,8 @@ import (
 )
 
 // return router helper method
-func getRoute(router *vi, method string) func(path string, handler http.HandlerFunc) {
-	var route func(path string, handler http.HandlerFunc)
+func getRoute(router *vi, method string) func(path string, handler http.HandlerFunc, middlewares ...middleware) *Route {
+	var route func(path string, handler http.HandlerFunc, middlewares ...middleware) *Route
 	switch method {
 	case "GET":
 		route = router.GET
@@ -33,8 +33,6 @@ func getRoute(router *vi, method string) func(path string, handler http.HandlerF
 // build check ,  register handler for each path with  given method and assert the handler has been call and return correct payload
 func checkSimpleResponse(url, path string, expectFail bool) {
 	router := New(&Config{Banner: false})
-	//  validate trees == nil  case
-	router.trees = nil
 
 	h := func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprint(w, r.URL.Path)
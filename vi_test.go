@@ -1,11 +1,17 @@
 package vi
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strconv"
+	"sync"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -137,10 +143,149 @@ var _ = Describe("Test with middlewares", func() {
 		Ω(func() { r.Add("GET", "", func(w http.ResponseWriter, r *http.Request) {}) }).Should(Panic())
 
 		Ω(func() { r.Add("GET", "/", nil) }).Should(Panic())
+		Ω(func() { r.Add("GET", "/{id:[0-9}", func(w http.ResponseWriter, r *http.Request) {}) }).Should(Panic())
 	})
 
 })
 
+var _ = Describe("Method not allowed", func() {
+	var v *vi
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+
+	BeforeEach(func() {
+		v = New(&Config{Banner: false})
+		v.GET("/user", handler)
+		v.PUT("/user", handler)
+		v.GET("/profile/:name", handler)
+		v.DELETE("/profile/{id:[0-9]+}", handler)
+	})
+
+	DescribeTable("Should response 405 with the Allow header", func(method, url string, expectStatus int, expectAllow string) {
+		req := httptest.NewRequest(method, url, http.NoBody)
+		rec := httptest.NewRecorder()
+		v.ServeHTTP(rec, req)
+
+		Expect(rec.Result().StatusCode).To(Equal(expectStatus))
+		Expect(rec.Header().Get("Allow")).To(Equal(expectAllow))
+	},
+		Entry("static route", "POST", "/user", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS, PUT"),
+		Entry("regex route", "POST", "/profile/101", http.StatusMethodNotAllowed, "DELETE, GET, HEAD, OPTIONS"),
+		Entry("regex route with constraint", "POST", "/profile/anh", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS"),
+		Entry("unknown method", "PROPFIND", "/user", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS, PUT"),
+		Entry("registered method", "PUT", "/user", http.StatusOK, ""),
+		Entry("no route", "POST", "/notfound", http.StatusNotFound, ""),
+	)
+
+	It("Should call custom method not allowed handler", func() {
+		v := New(&Config{Banner: false, MethodNotAllowedHandler: func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("allow: " + w.Header().Get("Allow")))
+		}})
+		v.GET("/user", handler)
+
+		req := httptest.NewRequest("POST", "/user", http.NoBody)
+		rec := httptest.NewRecorder()
+		v.ServeHTTP(rec, req)
+
+		Expect(rec.Result().StatusCode).To(Equal(http.StatusMethodNotAllowed))
+		Expect(rec.Body.String()).To(Equal("allow: GET, HEAD, OPTIONS"))
+	})
+})
+
+var _ = Describe("Automatic HEAD and OPTIONS", func() {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Handler", r.Method)
+		w.Write([]byte("body"))
+	}
+
+	It("Should serve HEAD with the GET handler and discard the body", func() {
+		v := New(&Config{Banner: false})
+		v.GET("/user/:name", handler)
+		server := httptest.NewServer(v)
+		defer server.Close()
+
+		res, err := http.Head(server.URL + "/user/anh")
+		Expect(err).ToNot(HaveOccurred())
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		Expect(res.Header.Get("X-Handler")).To(Equal("HEAD"))
+		Expect(res.ContentLength).To(Equal(int64(len("body"))))
+		Expect(body).To(BeEmpty())
+	})
+
+	It("Should pass the writer unchanged to the GET handler of HEAD request", func() {
+		v := New(&Config{Banner: false})
+		v.GET("/stream", func(w http.ResponseWriter, r *http.Request) {
+			_, ok := w.(http.Flusher)
+			w.Header().Set("X-Flusher", strconv.FormatBool(ok))
+		})
+
+		req := httptest.NewRequest("HEAD", "/stream", http.NoBody)
+		rec := httptest.NewRecorder()
+		v.ServeHTTP(rec, req)
+		Expect(rec.Header().Get("X-Flusher")).To(Equal("true"))
+	})
+
+	It("Should answer OPTIONS with the Allow header", func() {
+		v := New(&Config{Banner: false})
+		v.GET("/user", handler)
+		v.POST("/user", handler)
+
+		req := httptest.NewRequest("OPTIONS", "/user", http.NoBody)
+		rec := httptest.NewRecorder()
+		v.ServeHTTP(rec, req)
+
+		Expect(rec.Result().StatusCode).To(Equal(http.StatusNoContent))
+		Expect(rec.Header().Get("Allow")).To(Equal("GET, HEAD, OPTIONS, POST"))
+
+		req = httptest.NewRequest("OPTIONS", "/notfound", http.NoBody)
+		rec = httptest.NewRecorder()
+		v.ServeHTTP(rec, req)
+		Expect(rec.Result().StatusCode).To(Equal(http.StatusNotFound))
+	})
+
+	It("Should prefer explicit HEAD and OPTIONS handler", func() {
+		v := New(&Config{Banner: false})
+		v.GET("/user", handler)
+		v.HEAD("/user", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Handler", "explicit head")
+		})
+		v.OPTIONS("/user", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("explicit options"))
+		})
+
+		req := httptest.NewRequest("HEAD", "/user", http.NoBody)
+		rec := httptest.NewRecorder()
+		v.ServeHTTP(rec, req)
+		Expect(rec.Header().Get("X-Handler")).To(Equal("explicit head"))
+
+		req = httptest.NewRequest("OPTIONS", "/user", http.NoBody)
+		rec = httptest.NewRecorder()
+		v.ServeHTTP(rec, req)
+		Expect(rec.Result().StatusCode).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(Equal("explicit options"))
+	})
+
+	It("Should be disable through config", func() {
+		v := New(&Config{Banner: false, DisableAutoHead: true, DisableAutoOptions: true})
+		v.GET("/user", handler)
+
+		req := httptest.NewRequest("HEAD", "/user", http.NoBody)
+		rec := httptest.NewRecorder()
+		v.ServeHTTP(rec, req)
+		Expect(rec.Result().StatusCode).To(Equal(http.StatusMethodNotAllowed))
+		Expect(rec.Header().Get("Allow")).To(Equal("GET"))
+
+		req = httptest.NewRequest("OPTIONS", "/user", http.NoBody)
+		rec = httptest.NewRecorder()
+		v.ServeHTTP(rec, req)
+		Expect(rec.Result().StatusCode).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
+
 var _ = Describe("Serving Static with simple file content and header", func() {
 	maxAge := 2
 	v := New(&Config{Banner: false})
@@ -265,33 +410,647 @@ var _ = Describe("Edge Cases", func() {
 		Expect(rec.Result().StatusCode).To(Equal(http.StatusInternalServerError))
 		Expect(rec.Body.String()).To(Equal("500 server internal error"))
 	})
-	It("Should return not found when receive method other then GET", func() {
+	It("Should return method not allowed when receive method other then GET", func() {
 		v.Static("/", &StaticConfig{Root: http.Dir("./.github/testdata/fs")})
 		req := httptest.NewRequest("DELETE", "/index.html", http.NoBody)
 
 		v.ServeHTTP(rec, req)
 
-		Expect(rec.Result().StatusCode).To(Equal(http.StatusNotFound))
+		Expect(rec.Result().StatusCode).To(Equal(http.StatusMethodNotAllowed))
+		Expect(rec.Header().Get("Allow")).To(Equal("GET, HEAD, OPTIONS"))
 	})
 
-	It("if file is dir , return index", func() {
+	It("if file is dir , return index inside the dir", func() {
 		v.Static("/", &StaticConfig{Root: http.Dir("./.github/testdata/fs/")})
-		req := httptest.NewRequest("GET", "/css", http.NoBody)
+		req := httptest.NewRequest("GET", "/sub/", http.NoBody)
 
 		v.ServeHTTP(rec, req)
 
+		content, _ := os.ReadFile("./.github/testdata/fs/sub/index.html")
 		Expect(rec.Result().StatusCode).To(Equal(http.StatusOK))
 		Expect(rec.Result().Header.Get("Content-Type")).To(Equal("text/html"))
+		Expect(rec.Body.Bytes()).To(Equal(content))
+	})
+
+	It("if dir is request without trailing slash , redirect", func() {
+		v.Static("/", &StaticConfig{Root: http.Dir("./.github/testdata/fs/")})
+		req := httptest.NewRequest("GET", "/sub?page=1", http.NoBody)
+
+		v.ServeHTTP(rec, req)
+
+		Expect(rec.Result().StatusCode).To(Equal(http.StatusMovedPermanently))
+		Expect(rec.Header().Get("Location")).To(Equal("/sub/?page=1"))
 	})
 
 	It("if index file couldn't be open", func() {
 		v.Static("/", &StaticConfig{Root: http.Dir("./.github/testdata/fs/"), Index: "notfoundindex.html"})
-		req := httptest.NewRequest("GET", "/css", http.NoBody)
+		req := httptest.NewRequest("GET", "/css/", http.NoBody)
 
-		Ω(func() {
-			v.ServeHTTP(rec, req)
-		}).Should(Panic())
+		v.ServeHTTP(rec, req)
 
+		Expect(rec.Result().StatusCode).To(Equal(http.StatusForbidden))
+		Expect(rec.Body.String()).To(Equal("403 Forbidden"))
 	})
 
 })
+
+var _ = Describe("Route priority", func() {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+
+	DescribeTable("Should serve the most specific route regardless of registration order", func(url string, expectPath string) {
+		paths := []string{"/*", "/user/:name", "/user/{id:[0-9]+}", "/user/me"}
+		orders := [][]int{{0, 1, 2, 3}, {3, 2, 1, 0}}
+		// shuffle with fixed seed , so failure can be reproduced
+		rnd := rand.New(rand.NewSource(42))
+		for i := 0; i < 8; i++ {
+			orders = append(orders, rnd.Perm(len(paths)))
+		}
+
+		for _, order := range orders {
+			v := New(&Config{Banner: false})
+			for _, i := range order {
+				v.GET(paths[i], handler)
+			}
+
+			route, ok := v.Match(httptest.NewRequest("GET", url, http.NoBody))
+			Expect(ok).To(BeTrue(), "order %v", order)
+			Expect(route.GetPath()).To(Equal(expectPath), "order %v", order)
+		}
+	},
+		Entry("static", "/user/me", "/user/me"),
+		Entry("regex param", "/user/101", "/user/{id:[0-9]+}"),
+		Entry("named param", "/user/anh", "/user/:name"),
+		Entry("wildcard", "/video/anh", "/*"),
+	)
+
+	It("Should report which route serve HEAD request", func() {
+		v := New(&Config{Banner: false})
+		v.GET("/user", handler)
+
+		route, ok := v.Match(httptest.NewRequest("HEAD", "/user", http.NoBody))
+		Expect(ok).To(BeTrue())
+		Expect(route.GetMethod()).To(Equal("GET"))
+
+		_, ok = v.Match(httptest.NewRequest("POST", "/user", http.NoBody))
+		Expect(ok).To(BeFalse())
+	})
+
+	It("Should panic on duplicate route and warn on ambiguous route", func() {
+		var buf bytes.Buffer
+		log.SetOutput(&buf)
+		defer log.SetOutput(os.Stderr)
+
+		v := New(&Config{Banner: false})
+		v.GET("/user/{id:[0-9]+}", handler)
+		v.GET("/user/{slug:[a-z0-9]+}", handler)
+		Expect(buf.String()).To(ContainSubstring("overlap with /user/{id:[0-9]+}"))
+
+		Ω(func() { v.GET("/user/{id:[0-9]+}", handler) }).Should(Panic())
+	})
+})
+
+var _ = Describe("Full path and prefix matching", func() {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+
+	DescribeTable("Should match the whole path unless prefix matching is requested", func(url string, expectPath string) {
+		v := New(&Config{Banner: false})
+		v.GET("/user/:id", handler)
+		v.GET(`/asset/{file:.+\.js}`, handler)
+		v.GET(`/bundle/{file...:.+\.js}`, handler)
+		v.Prefix("GET", "/api/", handler)
+
+		route, ok := v.Match(httptest.NewRequest("GET", url, http.NoBody))
+		if expectPath == "" {
+			Expect(ok).To(BeFalse(), "%s should not match %v", url, route)
+			return
+		}
+		Expect(ok).To(BeTrue())
+		Expect(route.GetPath()).To(Equal(expectPath))
+	},
+		Entry("exact", "/user/12", "/user/:id"),
+		Entry("extra segment", "/user/12/extra", ""),
+		Entry("leading segment", "/v1/user/12", ""),
+		Entry("regex bounded by segment", "/asset/lib/app.js", ""),
+		Entry("regex in segment", "/asset/app.js", `/asset/{file:.+\.js}`),
+		Entry("spanning regex", "/bundle/lib/app.js", `/bundle/{file...:.+\.js}`),
+		Entry("prefix", "/api", "/api/*"),
+		Entry("under prefix", "/api/users/1", "/api/*"),
+		Entry("prefix at segment boundary", "/apiv2", ""),
+	)
+})
+
+var _ = Describe("Catch all and mixed segment", func() {
+	var v *vi
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		for _, p := range Params(r) {
+			fmt.Fprintf(w, "%s=%s ", p.Key, p.Value)
+		}
+	}
+
+	BeforeEach(func() {
+		v = New(&Config{Banner: false})
+		v.GET("/files/*path", handler)
+		v.GET("/files/*path/raw", handler)
+		v.GET("/img/:name.:ext", handler)
+		v.GET("/img/:name", handler)
+		v.GET("/v:version/users", handler)
+		v.GET("/@:handle", handler)
+		v.GET("/:page", handler)
+	})
+
+	DescribeTable("Should capture the params", func(url string, expectBody string) {
+		rec := httptest.NewRecorder()
+		v.ServeHTTP(rec, httptest.NewRequest("GET", url, http.NoBody))
+		Expect(rec.Body.String()).To(Equal(expectBody))
+	},
+		Entry("catch all", "/files/docs/a.txt", "path=docs/a.txt "),
+		Entry("catch all with nothing", "/files/", "path= "),
+		Entry("catch all in the middle", "/files/docs/a.txt/raw", "path=docs/a.txt "),
+		Entry("mixed segment is more specific", "/img/photo.png", "name=photo ext=png "),
+		Entry("param when mixed segment not match", "/img/photo", "name=photo "),
+		Entry("literal prefix", "/v2/users", "version=2 "),
+		Entry("symbol prefix", "/@anh", "handle=anh "),
+		Entry("param when symbol prefix not match", "/anh", "page=anh "),
+	)
+})
+
+var _ = Describe("Concurrent routing and registration", func() {
+	It("Should be race free when serving while registering", func() {
+		v := New(&Config{Banner: false})
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(GetParam(r, "name")))
+		}
+		v.GET("/user/:name", handler)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(2)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					rec := httptest.NewRecorder()
+					v.ServeHTTP(rec, httptest.NewRequest("GET", "/user/anh", http.NoBody))
+					Expect(rec.Body.String()).To(Equal("anh"))
+					v.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", fmt.Sprintf("/post/%d/%d", i, j), http.NoBody))
+				}
+			}(i)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				g := v.Group(fmt.Sprintf("/group%d", i))
+				g.Use(func(next http.HandlerFunc) http.HandlerFunc { return next })
+				for j := 0; j < 50; j++ {
+					RegisterHelper(fmt.Sprintf("helper%d", i), `[a-z]+`)
+					g.POST(fmt.Sprintf("/post/%d/%d", i, j), handler).
+						Name(fmt.Sprintf("post-%d-%d", i, j)).
+						Headers("X-Request", "")
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		url, err := v.URL("post-7-49")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(url).To(Equal("/post/7/49"))
+	})
+})
+
+var _ = Describe("Live route modification", func() {
+	var v *vi
+	respond := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body + GetParam(r, "name")))
+		}
+	}
+	serve := func(v *vi, method, url string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		v.ServeHTTP(rec, httptest.NewRequest(method, url, http.NoBody))
+		return rec
+	}
+
+	BeforeEach(func() {
+		v = New(&Config{Banner: false})
+		v.GET("/user/:name", respond("user ")).Name("user")
+		v.GET("/user/{id:[0-9]+}", respond("id"))
+		v.POST("/user/:name", respond("create "))
+	})
+
+	It("Should remove route and its name", func() {
+		Expect(v.Remove("GET", "/user/:name")).To(Succeed())
+
+		Expect(serve(v, "GET", "/user/anh").Code).To(Equal(http.StatusMethodNotAllowed))
+		Expect(serve(v, "GET", "/user/101").Body.String()).To(Equal("id"))
+		Expect(serve(v, "POST", "/user/anh").Body.String()).To(Equal("create anh"))
+		_, err := v.URL("user", "name", "anh")
+		Expect(err).To(MatchError(ErrRouteNotFound))
+
+		Expect(v.Remove("POST", "/user/:name")).To(Succeed())
+		Expect(v.Remove("POST", "/user/:name")).To(MatchError(ErrRouteNotFound))
+		Expect(v.Remove("PUT", "/user/:name")).To(MatchError(ErrRouteNotFound))
+		Expect(serve(v, "POST", "/user/anh").Code).To(Equal(http.StatusNotFound))
+
+		v.GET("/user/:name", respond("again "))
+		Expect(serve(v, "GET", "/user/anh").Body.String()).To(Equal("again anh"))
+	})
+
+	It("Should replace handler while keeping the route", func() {
+		Expect(v.Replace("GET", "/user/:name", respond("replaced "))).To(Succeed())
+		Expect(v.Replace("GET", "/video/:name", respond(""))).To(MatchError(ErrRouteNotFound))
+
+		Expect(serve(v, "GET", "/user/anh").Body.String()).To(Equal("replaced anh"))
+		Expect(v.URL("user", "name", "anh")).To(Equal("/user/anh"))
+	})
+
+	It("Should swap the whole routing table", func() {
+		v.Use(func(next http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("old "))
+				next(w, r)
+			}
+		})
+
+		next := New(&Config{Banner: false})
+		next.GET("/video/:name", respond("video "))
+		v.Swap(next)
+
+		Expect(serve(v, "GET", "/video/anh").Body.String()).To(Equal("video anh"))
+		Expect(serve(v, "GET", "/user/anh").Code).To(Equal(http.StatusNotFound))
+		_, err := v.URL("user")
+		Expect(err).To(MatchError(ErrRouteNotFound))
+
+		// route of next now update v
+		rt, ok := v.Match(httptest.NewRequest("GET", "/video/anh", http.NoBody))
+		Expect(ok).To(BeTrue())
+		rt.Name("video")
+		Expect(v.URL("video", "name", "anh")).To(Equal("/video/anh"))
+	})
+
+	It("Should apply middleware registered after swap to the swapped in routes", func() {
+		mw := func(name string) middleware {
+			return func(next http.HandlerFunc) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(name + " "))
+					next(w, r)
+				}
+			}
+		}
+
+		next := New(&Config{Banner: false})
+		next.Use(mw("next"))
+		next.GET("/video/:name", respond("video "))
+		admin := next.Group("/admin")
+		admin.Use(mw("admin"))
+		admin.GET("/admin/user/:name", respond("admin "))
+		v.Swap(next)
+
+		v.Use(mw("after"))
+		v.GET("/audio/:name", respond("audio "))
+
+		Expect(serve(v, "GET", "/video/anh").Body.String()).To(Equal("next after video anh"))
+		Expect(serve(v, "GET", "/admin/user/anh").Body.String()).To(Equal("next after admin admin anh"))
+		Expect(serve(v, "GET", "/audio/anh").Body.String()).To(Equal("next after audio anh"))
+	})
+
+	It("Should not affect in flight request", func() {
+		started, release := make(chan struct{}), make(chan struct{})
+		v.GET("/slow", func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			w.Write([]byte("slow"))
+		})
+
+		done := make(chan *httptest.ResponseRecorder)
+		go func() {
+			done <- serve(v, "GET", "/slow")
+		}()
+		<-started
+
+		Expect(v.Remove("GET", "/slow")).To(Succeed())
+		v.Swap(New(nil))
+		close(release)
+
+		Expect((<-done).Body.String()).To(Equal("slow"))
+		Expect(serve(v, "GET", "/slow").Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("Should be race free when replacing while serving", func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(2)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					Expect(serve(v, "GET", "/user/anh").Code).To(Equal(http.StatusOK))
+				}
+			}()
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					Expect(v.Replace("GET", "/user/:name", respond(strconv.Itoa(i)))).To(Succeed())
+					Expect(v.Remove("GET", "/user/{id:[0-9]+}")).To(Or(Succeed(), MatchError(ErrRouteNotFound)))
+				}
+			}(i)
+		}
+		wg.Wait()
+	})
+})
+
+var _ = Describe("Path policies", func() {
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path + " " + GetParam(r, "name")))
+	}
+	newVi := func(config *Config) *vi {
+		v := New(config)
+		v.GET("/users", echo)
+		v.POST("/users", echo)
+		v.GET("/items/", echo)
+		v.GET("/files/*name", echo)
+		v.GET("/docs/{name:.+}/raw", echo)
+		v.GET("/tags/:name/raw", echo)
+		v.GET("/ids/{name:[0-9]+}", echo)
+		return v
+	}
+
+	DescribeTable("Should handle the path according to the policy", func(config Config, method, url string, expectStatus int, expect string) {
+		rec := httptest.NewRecorder()
+		newVi(&config).ServeHTTP(rec, httptest.NewRequest(method, url, http.NoBody))
+
+		Expect(rec.Code).To(Equal(expectStatus))
+		switch expectStatus {
+		case http.StatusMovedPermanently, http.StatusPermanentRedirect:
+			Expect(rec.Header().Get("Location")).To(Equal(expect))
+		case http.StatusOK:
+			Expect(rec.Body.String()).To(Equal(expect))
+		}
+	},
+		Entry("strict trailing slash", Config{}, "GET", "/users/", http.StatusNotFound, ""),
+		Entry("strict clean path", Config{}, "GET", "/files/../users", http.StatusOK, "/files/../users ../users"),
+		Entry("redirect remove slash", Config{TrailingSlash: PathRedirect}, "GET", "/users/?page=2", http.StatusMovedPermanently, "/users?page=2"),
+		Entry("redirect add slash", Config{TrailingSlash: PathRedirect}, "GET", "/items", http.StatusMovedPermanently, "/items/"),
+		Entry("redirect preserve method", Config{TrailingSlash: PathRedirect}, "POST", "/users/", http.StatusPermanentRedirect, "/users"),
+		Entry("redirect only to existing route", Config{TrailingSlash: PathRedirect}, "GET", "/other/", http.StatusNotFound, ""),
+		Entry("serve both", Config{TrailingSlash: PathServe}, "GET", "/users/", http.StatusOK, "/users "),
+		Entry("clean and redirect", Config{CleanPath: PathRedirect}, "GET", "//users/./", http.StatusMovedPermanently, "/users/"),
+		Entry("clean before matching catch all", Config{CleanPath: PathRedirect}, "GET", "/files/../users", http.StatusMovedPermanently, "/users"),
+		Entry("clean never redirect to other host", Config{CleanPath: PathRedirect}, "GET", "//evil.com/", http.StatusMovedPermanently, "/evil.com/"),
+		Entry("clean and serve", Config{CleanPath: PathServe, TrailingSlash: PathServe}, "GET", "/docs/../users//", http.StatusOK, "/users "),
+		Entry("encoded slash split segment", Config{}, "GET", "/docs/a%2Fb/raw", http.StatusNotFound, ""),
+		Entry("raw path keep encoded slash", Config{UseRawPath: true}, "GET", "/docs/a%2Fb/raw", http.StatusOK, "/docs/a/b/raw a/b"),
+		Entry("raw path decode each param", Config{UseRawPath: true}, "GET", "/files/a%2Fb/c%20d", http.StatusOK, "/files/a/b/c d a/b/c d"),
+		Entry("raw path decode named param before matching", Config{UseRawPath: true}, "GET", "/tags/%61nh/raw", http.StatusOK, "/tags/anh/raw anh"),
+		Entry("raw path decode regex param before matching", Config{UseRawPath: true}, "GET", "/ids/%31%30%31", http.StatusOK, "/ids/101 101"),
+		Entry("raw path match decoded value against param regex", Config{UseRawPath: true}, "GET", "/tags/a%2Fb/raw", http.StatusNotFound, ""),
+		Entry("raw path with clean", Config{UseRawPath: true, CleanPath: PathRedirect}, "GET", "/docs//a%2Fb/raw", http.StatusMovedPermanently, "/docs/a%2Fb/raw"),
+	)
+
+	DescribeTable("Should clean the path", func(path, expect string) {
+		Expect(cleanPath(path)).To(Equal(expect))
+	},
+		Entry("clean", "/users/1", "/users/1"),
+		Entry("root", "", "/"),
+		Entry("relative", "users", "/users"),
+		Entry("trailing slash", "/users/", "/users/"),
+		Entry("duplicate slashes", "//users///1", "/users/1"),
+		Entry("dot", "/./users/.", "/users"),
+		Entry("dot dot", "/a/b/../../users/", "/users/"),
+		Entry("dot dot beyond root", "/../../users", "/users"),
+	)
+})
+
+var _ = Describe("Case insensitive routing", func() {
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path + " " + GetParam(r, "name")))
+	}
+	newVi := func(policy PathPolicy) *vi {
+		v := New(&Config{CaseInsensitive: policy})
+		v.GET("/About/Team", echo)
+		v.GET("/about/jobs", echo)
+		v.GET("/users/:name/Profile", echo)
+		v.GET("/tags/{name:[a-z]+}", echo)
+		v.GET("/exact", echo)
+		v.GET("/EXACT", echo)
+
+		docs := v.Group("/docs").CaseInsensitive(PathServe)
+		docs.GET("/docs/Guide", echo)
+		v.CaseInsensitive(PathStrict).GET("/Strict/:name", echo)
+		return v
+	}
+
+	DescribeTable("Should match static segments according to the policy", func(policy PathPolicy, method, url string, expectStatus int, expect string) {
+		rec := httptest.NewRecorder()
+		newVi(policy).ServeHTTP(rec, httptest.NewRequest(method, url, http.NoBody))
+
+		Expect(rec.Code).To(Equal(expectStatus))
+		switch expectStatus {
+		case http.StatusMovedPermanently, http.StatusPermanentRedirect:
+			Expect(rec.Header().Get("Location")).To(Equal(expect))
+		case http.StatusOK:
+			Expect(rec.Body.String()).To(Equal(expect))
+		}
+	},
+		Entry("strict", PathStrict, "GET", "/about/team", http.StatusNotFound, ""),
+		Entry("exact casing", PathRedirect, "GET", "/About/Team", http.StatusOK, "/About/Team "),
+		Entry("redirect to registered casing", PathRedirect, "GET", "/ABOUT/team?x=1", http.StatusMovedPermanently, "/About/Team?x=1"),
+		Entry("redirect across split node", PathRedirect, "GET", "/About/Jobs", http.StatusMovedPermanently, "/about/jobs"),
+		Entry("redirect head", PathRedirect, "HEAD", "/about/team", http.StatusMovedPermanently, "/About/Team"),
+		Entry("serve with registered casing", PathServe, "GET", "/about/TEAM", http.StatusOK, "/About/Team "),
+		Entry("param keep its casing", PathServe, "GET", "/USERS/Anh/profile", http.StatusOK, "/users/Anh/Profile Anh"),
+		Entry("regex segment stay case sensitive", PathServe, "GET", "/Tags/Go", http.StatusNotFound, ""),
+		Entry("regex segment with static folded", PathServe, "GET", "/Tags/go", http.StatusOK, "/tags/go go"),
+		Entry("same casing is prefered", PathServe, "GET", "/EXACT", http.StatusOK, "/EXACT "),
+		Entry("group policy", PathStrict, "GET", "/DOCS/guide", http.StatusOK, "/docs/Guide "),
+		Entry("group policy does not leak", PathStrict, "GET", "/about/team", http.StatusNotFound, ""),
+		Entry("strict route is skip", PathServe, "GET", "/strict/anh", http.StatusNotFound, ""),
+	)
+
+	It("Should keep the case insensitive routes after remove", func() {
+		v := newVi(PathServe)
+		Expect(v.Remove("GET", "/exact")).To(Succeed())
+
+		rec := httptest.NewRecorder()
+		v.ServeHTTP(rec, httptest.NewRequest("GET", "/about/team", http.NoBody))
+		Expect(rec.Body.String()).To(Equal("/About/Team "))
+	})
+})
+
+var _ = Describe("Mount", func() {
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s %s %s", r.Method, r.URL.Path, OriginalPath(r), GetParam(r, "id"))
+	}
+	serve := func(v *vi, method, url string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		v.ServeHTTP(rec, httptest.NewRequest(method, url, http.NoBody))
+		return rec
+	}
+
+	It("Should strip the prefix and serve every method under it", func() {
+		v := New(nil)
+		v.Mount("/api/", http.HandlerFunc(echo))
+		v.GET("/apiv2", echo)
+
+		Expect(serve(v, "GET", "/api/users/1").Body.String()).To(Equal("GET /users/1 /api/users/1 "))
+		Expect(serve(v, "DELETE", "/api/users/1").Body.String()).To(Equal("DELETE /users/1 /api/users/1 "))
+		Expect(serve(v, "PROPFIND", "/api/dav").Body.String()).To(Equal("PROPFIND /dav /api/dav "))
+		Expect(serve(v, "REPORT", "/api").Body.String()).To(Equal("REPORT / /api "))
+		Expect(serve(v, "PROPFIND", "/apiv2").Code).To(Equal(http.StatusMethodNotAllowed))
+		Expect(serve(v, "OPTIONS", "/api").Body.String()).To(Equal("OPTIONS / /api "))
+		Expect(serve(v, "GET", "/api/").Body.String()).To(Equal("GET / /api/ "))
+		Expect(serve(v, "GET", "/apiv2").Body.String()).To(Equal("GET /apiv2 /apiv2 "))
+		Expect(v.OpenAPI(nil).Paths).To(HaveLen(1), "mounted handler is hidden")
+	})
+
+	It("Should serve the mount before the less specific catch all", func() {
+		sub := New(nil)
+		sub.GET("/users/:id", echo)
+
+		v := New(nil)
+		v.Static("/", &StaticConfig{Root: http.Dir("./.github/testdata/fs")})
+		v.Mount("/api", sub)
+		v.GET("/api/health", echo)
+
+		Expect(serve(v, "GET", "/api/users/7").Body.String()).To(Equal("GET /users/7 /api/users/7 7"))
+		Expect(serve(v, "HEAD", "/api/users/7").Code).To(Equal(http.StatusOK))
+		Expect(serve(v, "GET", "/api/health").Body.String()).To(Equal("GET /api/health /api/health "), "more specific route of the method")
+		Expect(serve(v, "GET", "/index.html").Code).To(Equal(http.StatusOK))
+
+		v = New(nil)
+		v.GET("/*", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("catch all")) })
+		v.Mount("/api", sub)
+		Expect(serve(v, "GET", "/api/users/7").Body.String()).To(Equal("GET /users/7 /api/users/7 7"))
+		Expect(serve(v, "GET", "/other").Body.String()).To(Equal("catch all"))
+	})
+
+	It("Should strip prefix with param and keep the raw path", func() {
+		v := New(&Config{UseRawPath: true})
+		v.Mount("/tenant/:name", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %s %s", r.URL.Path, r.URL.RawPath, GetParam(r, "name"))
+		}))
+
+		Expect(serve(v, "GET", "/tenant/acme/files/a%2Fb").Body.String()).To(Equal("/files/a/b /files/a%2Fb acme"))
+		Ω(func() { v.Mount("/files/:name?", http.NotFoundHandler()) }).Should(Panic())
+		Ω(func() { v.Mount("/files/*path", http.NotFoundHandler()) }).Should(Panic())
+		Ω(func() { v.Mount("/files", nil) }).Should(Panic())
+	})
+
+	It("Should serve mounted vi as subrouter", func() {
+		sub := New(&Config{
+			TrailingSlash: PathRedirect,
+			NotFoundHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+			},
+		})
+		sub.GET("/users/:id", echo)
+
+		v := New(nil)
+		var visited []string
+		v.Use(func(next http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				visited = append(visited, r.URL.Path)
+				next(w, r)
+			}
+		})
+		v.Mount("/v1", sub)
+		outer := New(nil)
+		outer.Mount("/outer", v)
+
+		Expect(serve(v, "GET", "/v1/users/7").Body.String()).To(Equal("GET /users/7 /v1/users/7 7"))
+		Expect(visited).To(Equal([]string{"/v1/users/7"}), "middleware see the path before stripping")
+		Expect(serve(v, "GET", "/v1/other").Code).To(Equal(http.StatusTeapot))
+		Expect(serve(v, "GET", "/v1/users/7/").Header().Get("Location")).To(Equal("/v1/users/7"))
+
+		rec := serve(outer, "GET", "/outer/v1/users/7/")
+		Expect(rec.Header().Get("Location")).To(Equal("/outer/v1/users/7"))
+		Expect(serve(outer, "GET", "/outer/v1/users/7").Body.String()).To(Equal("GET /users/7 /outer/v1/users/7 7"))
+	})
+})
+
+var _ = Describe("Middleware scoping", func() {
+	var (
+		v     *vi
+		trace []string
+		built int
+	)
+	mw := func(name string) middleware {
+		return func(next http.HandlerFunc) http.HandlerFunc {
+			built++
+			return func(w http.ResponseWriter, r *http.Request) {
+				trace = append(trace, name)
+				next(w, r)
+			}
+		}
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		trace = append(trace, "handler")
+	}
+	serve := func(url string) []string {
+		trace = nil
+		v.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", url, http.NoBody))
+		return trace
+	}
+
+	BeforeEach(func() {
+		v = New(nil)
+		v.Use(mw("root"))
+	})
+
+	It("Should not share middleware between groups with the same prefix", func() {
+		a, b := v.Group("/api"), v.Group("/api")
+		a.Use(mw("a"))
+		b.Use(mw("b"))
+		a.GET("/api/a", handler)
+		b.GET("/api/b", handler)
+
+		Expect(serve("/api/a")).To(Equal([]string{"root", "a", "handler"}))
+		Expect(serve("/api/b")).To(Equal([]string{"root", "b", "handler"}))
+	})
+
+	It("Should scope nested group middleware to its own subtree", func() {
+		api := v.Group("/api")
+		users := api.Group("/users")
+		posts := api.Group("/posts")
+		users.Use(mw("users"))
+		posts.GET("/api/posts", handler)
+		users.GET("/api/users", handler)
+		api.Use(mw("api"))
+
+		Expect(serve("/api/users")).To(Equal([]string{"root", "api", "users", "handler"}))
+		Expect(serve("/api/posts")).To(Equal([]string{"root", "api", "handler"}))
+		Expect(v.Routes()[0].Prefixes).To(Equal([]string{"/", "/api", "/posts"}))
+	})
+
+	It("Should run route middleware after the group middleware", func() {
+		g := v.Group("/admin")
+		g.Use(mw("admin"))
+		g.GET("/admin", handler, mw("auth"), mw("audit"))
+		v.GET("/", handler)
+
+		Expect(serve("/admin")).To(Equal([]string{"root", "admin", "auth", "audit", "handler"}))
+		Expect(serve("/")).To(Equal([]string{"root", "handler"}))
+		Expect(v.Routes()[0].Middlewares).To(Equal(4))
+	})
+
+	It("Should scope the middleware with With", func() {
+		v.With(mw("with")).GET("/private", handler)
+		v.GET("/public", handler)
+
+		Expect(serve("/private")).To(Equal([]string{"root", "with", "handler"}))
+		Expect(serve("/public")).To(Equal([]string{"root", "handler"}))
+	})
+
+	It("Should chain once at registration and keep the middleware on replace", func() {
+		v.GET("/user", handler, mw("route"))
+		built = 0
+		for i := 0; i < 3; i++ {
+			Expect(serve("/user")).To(Equal([]string{"root", "route", "handler"}))
+		}
+		Expect(built).To(BeZero(), "middleware should not be chain per request")
+
+		Expect(v.Replace("GET", "/user", func(w http.ResponseWriter, r *http.Request) {
+			trace = append(trace, "replaced")
+		})).To(Succeed())
+		Expect(serve("/user")).To(Equal([]string{"root", "route", "replaced"}))
+	})
+})
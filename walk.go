@@ -0,0 +1,74 @@
+package vi
+
+import (
+	"errors"
+	"sort"
+)
+
+// Return by the walk function to stop walking without error
+var ErrSkipAll = errors.New("skip all routes")
+
+// RouteInfo describe registered route , return by Routes and Walk
+type RouteInfo struct {
+	// http method of the route , * for the route that serve every method such as the mounted handler
+	Method string
+	// the route pattern
+	Path string
+	// name of the route , empty when anonymous
+	Name string
+	// prefixes of the group the route registered under , start with the root prefix /
+	Prefixes []string
+	// number of middlewares that will be chain before the handler , including the middlewares of the route
+	Middlewares int
+	// user metadata of the route
+	Metadata Metadata
+	// the registered route
+	Route *Route
+}
+
+// Routes return every registered route , sorted by method then registration order
+func (v *vi) Routes() []RouteInfo {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	t := v.table.Load()
+	methods := make([]string, 0, len(t.trees))
+	for method := range t.trees {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	var infos []RouteInfo
+	for _, method := range methods {
+		for _, leaf := range t.trees[method].leaves {
+			for _, rt := range leaf.routes {
+				infos = append(infos, RouteInfo{
+					Method:      rt.method,
+					Path:        rt.path,
+					Name:        rt.name,
+					Prefixes:    rt.scope.prefixes(),
+					Middlewares: len(t.middlewaresOf(rt)),
+					Metadata:    rt.meta.clone(),
+					Route:       rt,
+				})
+			}
+		}
+	}
+
+	return infos
+}
+
+// Walk call fn for every registered route in the same order as Routes
+// Walking stop at the first error return by fn , which is return by Walk unless it is ErrSkipAll
+// fn is call without holding any lock , so it can configure the route
+func (v *vi) Walk(fn func(info RouteInfo) error) error {
+	for _, info := range v.Routes() {
+		if err := fn(info); err != nil {
+			if errors.Is(err, ErrSkipAll) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}